@@ -0,0 +1,199 @@
+package p_log4go
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ======== ======== PLogger: Admin handler ======== ========
+
+// LoggerState state of a logger reported by the admin handler
+type LoggerState struct {
+	Name      string          `json:"name"`     // Dotted name, root for the root logger
+	Level     string          `json:"level"`    // e.g. INFO
+	LevelSet  bool            `json:"levelSet"` // Whether set on the logger, or inherited from the parent
+	Trace     bool            `json:"trace"`
+	Additive  bool            `json:"additive"`
+	Appenders []AppenderState `json:"appenders"`
+}
+
+// AppenderState state of an appender reported by the admin handler
+type AppenderState struct {
+	Type  string `json:"type"`            // e.g. WriterAppender
+	Level string `json:"level,omitempty"` // Min level appended, if the appender has one
+}
+
+// levelChange body of PUT/POST, fields not set are unchanged
+type levelChange struct {
+	Logger string  `json:"logger"` // Dotted name, root or empty for the root logger
+	Level  *string `json:"level"`  // e.g. DEBUG, or INHERIT to inherit the parent's again
+	Trace  *bool   `json:"trace"`  // StartTrace or StopTrace
+}
+
+// adminHandler http handler of the loggers in the registry
+type adminHandler struct {
+	reg *loggerRegistry
+}
+
+// AdminHandler http handler to inspect and change the named loggers at runtime, see GetNamedLogger. Mount it on a mux, e.g.
+//
+//	http.Handle("/debug/loggers", AdminHandler())
+//
+// GET lists the loggers with their level, trace state and appenders as JSON. PUT or POST changes a logger,
+// by a JSON body or form values, and replies its new state:
+//
+//	curl -X PUT localhost:8080/debug/loggers -H 'Content-Type: application/json' -d '{"logger": "com.app.db", "level": "DEBUG", "trace": true}'
+//	curl -X PUT 'localhost:8080/debug/loggers?logger=com.app.db&level=INHERIT&trace=false'
+//
+// It changes levels of the whole process, so guard it as other debug endpoints, e.g. by listening on localhost only.
+func AdminHandler() http.Handler {
+	return &adminHandler{reg: namedLoggers}
+}
+
+func (h *adminHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		states := make([]LoggerState, 0)
+		for _, l := range h.reg.all() {
+			states = append(states, loggerStateOf(l))
+		}
+		writeAdminJSON(w, http.StatusOK, map[string]interface{}{"loggers": states})
+	case http.MethodPut, http.MethodPost:
+		change, err := parseLevelChange(r)
+		if err != nil {
+			writeAdminError(w, http.StatusBadRequest, err)
+			return
+		}
+		l := h.reg.lookup(change.Logger)
+		if l == nil {
+			writeAdminError(w, http.StatusNotFound, fmt.Errorf("logger %q not found", change.Logger))
+			return
+		}
+		if change.Level != nil {
+			if strings.EqualFold(*change.Level, "INHERIT") {
+				l.ResetLevel()
+			} else {
+				level, err := ParseLevel(*change.Level)
+				if err != nil {
+					writeAdminError(w, http.StatusBadRequest, err)
+					return
+				}
+				l.SetLevel(level)
+			}
+		}
+		if change.Trace != nil && *change.Trace {
+			l.StartTrace()
+		} else if change.Trace != nil {
+			l.StopTrace()
+		}
+		writeAdminJSON(w, http.StatusOK, loggerStateOf(l))
+	default:
+		w.Header().Set("Allow", "GET, HEAD, PUT, POST")
+		writeAdminError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+	}
+}
+
+// parseLevelChange parse the change from the JSON body, or the form values
+func parseLevelChange(r *http.Request) (*levelChange, error) {
+	change := &levelChange{}
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "application/json" {
+		if err := json.NewDecoder(r.Body).Decode(change); err != nil {
+			return nil, fmt.Errorf("invalid JSON body, %v", err)
+		}
+		return change, nil
+	}
+	if err := r.ParseForm(); err != nil {
+		return nil, err
+	}
+	change.Logger = r.Form.Get("logger")
+	if _, ok := r.Form["level"]; ok {
+		level := r.Form.Get("level")
+		change.Level = &level
+	}
+	if _, ok := r.Form["trace"]; ok {
+		traceOn, err := strconv.ParseBool(r.Form.Get("trace"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid trace %q, must be true or false", r.Form.Get("trace"))
+		}
+		change.Trace = &traceOn
+	}
+	return change, nil
+}
+
+func writeAdminJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
+
+func writeAdminError(w http.ResponseWriter, status int, err error) {
+	writeAdminJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+// loggerStateOf state of the logger
+func loggerStateOf(l *PLogger) LoggerState {
+	state := LoggerState{
+		Name:      l.Name(),
+		Level:     l.GetLevel().String(),
+		Trace:     l.IsEnabled(trace),
+		Appenders: make([]AppenderState, 0),
+	}
+	if l.parent == nil {
+		state.Name = "root"
+	}
+	hierarchyMu.Lock()
+	state.LevelSet = l.levelSet || l.parent == nil
+	hierarchyMu.Unlock()
+	l.mu.Lock()
+	state.Additive = !l.nonAdditive
+	appenders := l.appendersLocked()
+	l.mu.Unlock()
+	for _, a := range appenders {
+		as := AppenderState{Type: strings.TrimLeft(fmt.Sprintf("%T", a), "*")}
+		if i := strings.LastIndexByte(as.Type, '.'); i >= 0 {
+			as.Type = as.Type[i+1:]
+		}
+		if la, ok := a.(interface{ Level() LogLevel }); ok {
+			as.Level = la.Level().String()
+		}
+		state.Appenders = append(state.Appenders, as)
+	}
+	return state
+}
+
+// lookup the logger by name without creating it, nil if not exist. Empty name or root is the root logger.
+func (reg *loggerRegistry) lookup(name string) *PLogger {
+	name = strings.Trim(name, ".")
+	if name == "" || name == "root" {
+		return reg.root
+	}
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	return reg.loggers[name]
+}
+
+// all loggers of the registry, the root first and then by name
+func (reg *loggerRegistry) all() []*PLogger {
+	reg.mu.Lock()
+	names := make([]string, 0, len(reg.loggers))
+	for name := range reg.loggers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	loggers := make([]*PLogger, 0, len(names)+1)
+	if reg.root != nil {
+		loggers = append(loggers, reg.root)
+	}
+	for _, name := range names {
+		loggers = append(loggers, reg.loggers[name])
+	}
+	reg.mu.Unlock()
+	return loggers
+}
@@ -0,0 +1,96 @@
+package p_log4go
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAdminHandler(t *testing.T) {
+	var buf bytes.Buffer
+	root := &PLogger{logLevel: INFO, out: &buf}
+	reg := newLoggerRegistry(root)
+	db := reg.get("com.app.db")
+	db.SetAdditivity(false)
+	db.AttachAppender(NewWriterAppender(&buf))
+	mux := http.NewServeMux()
+	mux.Handle("/debug/loggers", &adminHandler{reg: reg})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	do := func(method, query, contentType, body string) (int, string) {
+		t.Helper()
+		req, err := http.NewRequest(method, server.URL+"/debug/loggers"+query, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var out bytes.Buffer
+		out.ReadFrom(resp.Body)
+		return resp.StatusCode, out.String()
+	}
+
+	status, body := do(http.MethodGet, "", "", "")
+	var list struct{ Loggers []LoggerState }
+	if err := json.Unmarshal([]byte(body), &list); err != nil || status != http.StatusOK {
+		t.Fatalf("got %d %s, err %v", status, body, err)
+	}
+	var names []string
+	for _, s := range list.Loggers {
+		names = append(names, s.Name)
+	}
+	if got := strings.Join(names, ","); got != "root,com,com.app,com.app.db" {
+		t.Errorf("got loggers %s", got)
+	}
+	if got := list.Loggers[3]; got.Level != "INFO" || got.LevelSet || got.Additive || len(got.Appenders) != 1 ||
+		got.Appenders[0].Type != "WriterAppender" {
+		t.Errorf("got db state %+v", got)
+	}
+
+	// JSON body
+	status, body = do(http.MethodPut, "", "application/json", `{"logger": "com.app", "level": "debug", "trace": true}`)
+	if status != http.StatusOK || !strings.Contains(body, `"level": "DEBUG"`) {
+		t.Errorf("got %d %s", status, body)
+	}
+	if db.GetLevel() != DEBUG || !reg.get("com.app").IsEnabled(trace) || !db.IsEnabled(trace) {
+		t.Errorf("got db level %v, trace %v, want DEBUG and trace on cascaded", db.GetLevel(), db.IsEnabled(trace))
+	}
+	db.Debug("debug on")
+	db.Trace("trace on")
+	// Form values
+	status, _ = do(http.MethodPost, "?logger=com.app&level=INHERIT&trace=false", "", "")
+	if status != http.StatusOK || db.GetLevel() != INFO || reg.get("com.app").IsEnabled(trace) || db.IsEnabled(trace) {
+		t.Errorf("got %d, db level %v, trace %v, want INFO inherited and trace off", status, db.GetLevel(), db.IsEnabled(trace))
+	}
+	db.Debug("Shouldn't see this")
+	db.Trace("Shouldn't see this")
+	if got := buf.String(); !strings.HasSuffix(got, "debug on\n[TRACE] trace on\n") || strings.Count(got, "\n") != 2 {
+		t.Errorf("got output %q", got)
+	}
+
+	tests := []struct {
+		method, query, body string
+		status              int
+		want                string
+	}{
+		{http.MethodPut, "?logger=com.nope&level=INFO", "", http.StatusNotFound, `logger \"com.nope\" not found`},
+		{http.MethodPut, "?logger=com&level=LOUD", "", http.StatusBadRequest, `unknown level \"LOUD\"`},
+		{http.MethodPut, "?logger=com&trace=maybe", "", http.StatusBadRequest, `invalid trace`},
+		{http.MethodDelete, "", "", http.StatusMethodNotAllowed, `method DELETE not allowed`},
+	}
+	for _, tt := range tests {
+		if status, body := do(tt.method, tt.query, "", tt.body); status != tt.status || !strings.Contains(body, tt.want) {
+			t.Errorf("%s %s got %d %s, want %d %s", tt.method, tt.query, status, body, tt.status, tt.want)
+		}
+	}
+}
@@ -0,0 +1,241 @@
+package p_log4go
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+)
+
+// ======== ======== PLogger: Appender ======== ========
+
+// Appender an output of records. Implement it to plug in your own output by PLogger.AttachAppender.
+// Append may be called concurrently, and the record must not be retained after Append returns.
+type Appender interface {
+	// Append writes the record, records below the appender level are ignored
+	Append(r *Record) error
+	// Flush commits buffered records to the storage
+	Flush() error
+	// Close flushes and releases the output, appending after closed returns ErrClosed
+	Close() error
+}
+
+// WriterAppender appender formatting records to an io.Writer, with its own level threshold and formatter.
+// The console and the timed rotating file appenders are WriterAppenders.
+type WriterAppender struct {
+	appenderLayout
+	flag AppenderFlag // ConsoleAppender or FileAppender for the built in appenders, 0 otherwise
+	mu   sync.Mutex   // ensures atomic writes; protects the following fields
+	w    io.Writer    // Destination
+	buf  []byte       // for accumulating text to write
+}
+
+// appenderLayout level threshold and formatter of an appender formatting records
+type appenderLayout struct {
+	level     int32        // Min LogLevel appended
+	formatter atomic.Value // formatterHolder, the formatter of the logger is used if not set
+}
+
+// defaultFormatter formatter of records appended not by a logger
+var defaultFormatter Formatter = &TextFormatter{Flag: LstdFlags}
+
+// NewWriterAppender appender of all levels to w, formatting by the logger formatter
+func NewWriterAppender(w io.Writer) *WriterAppender {
+	return &WriterAppender{w: w}
+}
+
+// NewConsoleAppender appender to stdout, plain. See NewColorConsoleAppender to colorize levels on terminals.
+func NewConsoleAppender() *WriterAppender {
+	return &WriterAppender{flag: ConsoleAppender, w: os.Stdout}
+}
+
+// NewFileAppender appender to the file rotated by the conf, the file dir is created if not exist
+func NewFileAppender(filePath string, conf RotateConf) (*WriterAppender, error) {
+	fileDir := filepath.Dir(filePath)
+	exist, err := pathExists(fileDir)
+	if err != nil {
+		return nil, fmt.Errorf("log file path err, %v", err)
+	}
+
+	if !exist {
+		if err = os.MkdirAll(fileDir, 0755); err != nil {
+			return nil, fmt.Errorf("mkdir logfile dir err, %v", err)
+		}
+	}
+
+	fileWriter, err := newTimedRotateWriter(filePath, conf)
+	if err != nil {
+		return nil, err
+	}
+	return &WriterAppender{flag: FileAppender, w: fileWriter}, nil
+}
+
+// SetLevel set min level appended, e.g. WARN to console while DEBUG to file. It's safe to change while logging.
+func (a *appenderLayout) SetLevel(level LogLevel) {
+	atomic.StoreInt32(&a.level, int32(level))
+}
+
+// Level min level appended
+func (a *appenderLayout) Level() LogLevel {
+	return LogLevel(atomic.LoadInt32(&a.level))
+}
+
+// SetFormatter set formatter of the appender, e.g. JSON to file while text to console.
+// It's safe to change while logging.
+func (a *appenderLayout) SetFormatter(formatter Formatter) {
+	a.formatter.Store(formatterHolder{formatter: formatter})
+}
+
+// Formatter of the appender, nil if the logger formatter is used
+func (a *appenderLayout) Formatter() Formatter {
+	if holder, ok := a.formatter.Load().(formatterHolder); ok {
+		return holder.formatter
+	}
+	return nil
+}
+
+// formatterOf formatter of the record: the appender's, the logger's, or the default
+func (a *appenderLayout) formatterOf(r *Record) Formatter {
+	if formatter := a.Formatter(); formatter != nil {
+		return formatter
+	}
+	if r.formatter != nil {
+		return r.formatter
+	}
+	return defaultFormatter
+}
+
+// recordNeeds record info needed by the formatter of the appender
+func (a *appenderLayout) recordNeeds() recordNeed {
+	return recordNeedsOf(a.Formatter())
+}
+
+// Append formats the record and writes it, if its level is enabled
+func (a *WriterAppender) Append(r *Record) error {
+	if r.Level < a.Level() {
+		return nil
+	}
+	formatter := a.formatterOf(r)
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.buf = formatter.Format(a.buf[:0], r)
+	_, err := a.w.Write(a.buf)
+	return err
+}
+
+// appenderFlag ConsoleAppender or FileAppender for the built in appenders
+func (a *WriterAppender) appenderFlag() AppenderFlag {
+	return a.flag
+}
+
+// Flush commits the writer to its storage if supported
+func (a *WriterAppender) Flush() error {
+	return syncWriter(a.w)
+}
+
+// Close flushes and closes the writer if supported, except the console
+func (a *WriterAppender) Close() error {
+	return closeWriter(a.w)
+}
+
+// Reopen reopens the file by its path if the writer is a file appender's
+func (a *WriterAppender) Reopen() error {
+	if r, ok := a.w.(interface{ Reopen() error }); ok {
+		return r.Reopen()
+	}
+	return nil
+}
+
+// AttachAppender attach the appender to the logger at runtime, records are appended to all attached appenders
+func (l *PLogger) AttachAppender(appender Appender) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	// Copy on write, the appenders are appended to without holding l.mu
+	appenders := make([]Appender, 0, len(l.appenders)+1)
+	l.appenders = append(append(appenders, l.appendersLocked()...), appender)
+}
+
+// DetachAppender detach the appender from the logger, it's not closed. Returns false if not attached.
+// Records queued by async writing before detached may not reach the appender.
+func (l *PLogger) DetachAppender(appender Appender) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	current := l.appendersLocked()
+	for i, a := range current {
+		if a == appender {
+			appenders := make([]Appender, 0, len(current)-1)
+			l.appenders = append(append(appenders, current[:i]...), current[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Appenders attached to the logger
+func (l *PLogger) Appenders() []Appender {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]Appender(nil), l.appendersLocked()...)
+}
+
+// appendersLocked appenders of the logger, out is wrapped as an appender if none attached. l.mu must be held.
+func (l *PLogger) appendersLocked() []Appender {
+	if l.appenders == nil && l.out != nil {
+		l.appenders = []Appender{NewWriterAppender(l.out)}
+	}
+	return l.appenders
+}
+
+// SetAppenderLevel set min level of the built in appenders by the flag, e.g. WARN to console while DEBUG to file.
+// Records must pass the logger level first. It's safe to change while logging.
+func (l *PLogger) SetAppenderLevel(flag AppenderFlag, level LogLevel) {
+	for _, a := range l.Appenders() {
+		if fa, ok := a.(flaggedAppender); ok && fa.appenderFlag()&flag != 0 {
+			fa.SetLevel(level)
+		}
+	}
+}
+
+// SetAppenderFormatter set formatter of the built in appenders by the flag, e.g. JSON to file while text to console.
+// Appenders without a formatter use the logger formatter. It's safe to change while logging.
+func (l *PLogger) SetAppenderFormatter(flag AppenderFlag, formatter Formatter) {
+	for _, a := range l.Appenders() {
+		if fa, ok := a.(flaggedAppender); ok && fa.appenderFlag()&flag != 0 {
+			fa.SetFormatter(formatter)
+		}
+	}
+}
+
+// flaggedAppender a built in appender of GetLogger
+type flaggedAppender interface {
+	appenderFlag() AppenderFlag
+	SetLevel(level LogLevel)
+	SetFormatter(formatter Formatter)
+}
+
+// appendRecord appends the record to each appender, a failed appender doesn't stop the others.
+// Returns the first error not reported yet if any, see reportedError.
+func appendRecord(appenders []Appender, r *Record) error {
+	var err error
+	for _, a := range appenders {
+		appendErr := a.Append(r)
+		if appendErr == nil {
+			continue
+		}
+		if _, reported := err.(reportedError); err == nil || reported {
+			err = appendErr
+		}
+	}
+	return err
+}
+
+// recordNeedsOfAppenders record info needed by the logger formatter and the appenders
+func recordNeedsOfAppenders(formatter Formatter, appenders []Appender) recordNeed {
+	needs := recordNeedsOf(formatter)
+	for _, a := range appenders {
+		needs |= recordNeedsOf(a)
+	}
+	return needs
+}
@@ -0,0 +1,107 @@
+package p_log4go
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// memoryAppender a custom appender keeping the messages
+type memoryAppender struct {
+	messages []string
+	flushed  bool
+	closed   bool
+}
+
+func (a *memoryAppender) Append(r *Record) error {
+	if a.closed {
+		return ErrClosed
+	}
+	a.messages = append(a.messages, r.Level.String()+" "+r.Message)
+	return nil
+}
+
+func (a *memoryAppender) Flush() error {
+	a.flushed = true
+	return nil
+}
+
+func (a *memoryAppender) Close() error {
+	a.closed = true
+	return nil
+}
+
+func TestAppenderLevelAndFormatter(t *testing.T) {
+	var console, file bytes.Buffer
+	appenderLogger := &PLogger{logLevel: DEBUG, appenders: []Appender{
+		&WriterAppender{flag: ConsoleAppender, w: &console},
+		&WriterAppender{flag: FileAppender, w: &file},
+	}}
+	appenderLogger.SetAppenderLevel(ConsoleAppender, WARN)
+	appenderLogger.SetAppenderFormatter(FileAppender, &JSONFormatter{})
+
+	appenderLogger.Debug("debug")
+	appenderLogger.Infow("info", Int("n", 1))
+	appenderLogger.Warn("warn")
+
+	if got := console.String(); got != "[WARN] warn\n" {
+		t.Errorf("got console %q, want WARN+ only", got)
+	}
+	lines := strings.Split(strings.TrimSuffix(file.String(), "\n"), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("got %d file lines, want 3: %q", len(lines), file.String())
+	}
+	for i, want := range []string{"debug", "info", "warn"} {
+		var obj map[string]interface{}
+		if err := json.Unmarshal([]byte(lines[i]), &obj); err != nil || obj["msg"] != want {
+			t.Errorf("got file line %s (%v), want JSON msg %q", lines[i], err, want)
+		}
+	}
+
+	// Both appenders by the bitmask, the logger formatter for appenders without their own
+	appenderLogger.SetAppenderLevel(ConsoleAppender|FileAppender, ERROR)
+	appenderLogger.SetFormatter(levelMsgFormatter{})
+	console.Reset()
+	file.Reset()
+	appenderLogger.Warn("warn")
+	appenderLogger.Error("error")
+	if got := console.String(); got != "ERROR|error\n" {
+		t.Errorf("got console %q", got)
+	}
+	if got := file.String(); !strings.HasPrefix(got, `{"level":"ERROR"`) || strings.Count(got, "\n") != 1 {
+		t.Errorf("got file %q", got)
+	}
+}
+
+func TestAttachAppender(t *testing.T) {
+	var buf bytes.Buffer
+	appenderLogger := &PLogger{logLevel: DEBUG, out: &buf}
+	memory := &memoryAppender{}
+	appenderLogger.AttachAppender(memory)
+	if n := len(appenderLogger.Appenders()); n != 2 {
+		t.Fatalf("got %d appenders, want out and the attached one", n)
+	}
+
+	appenderLogger.Info("attached")
+	if !appenderLogger.DetachAppender(memory) || appenderLogger.DetachAppender(memory) {
+		t.Errorf("detach should succeed once")
+	}
+	appenderLogger.Info("detached")
+
+	if got := strings.Join(memory.messages, ","); got != "INFO attached" {
+		t.Errorf("got appended %q", got)
+	}
+	if got := buf.String(); got != "[INFO] attached\n[INFO] detached\n" {
+		t.Errorf("got out %q", got)
+	}
+
+	// Sync and close reach attached appenders, the detached one is left to its owner
+	other := &memoryAppender{}
+	appenderLogger.AttachAppender(other)
+	appenderLogger.Sync()
+	appenderLogger.Close()
+	if !other.flushed || !other.closed || memory.flushed || memory.closed {
+		t.Errorf("got attached %+v, detached %+v", other, memory)
+	}
+}
@@ -0,0 +1,199 @@
+package p_log4go
+
+import (
+	"sync"
+)
+
+// ======== ======== PLogger: Async writing ======== ========
+
+// OverflowPolicy what to do when logging to a full async queue
+type OverflowPolicy int8
+
+const (
+	OverflowBlock          OverflowPolicy = iota // Block the caller until the queue has room
+	OverflowDropNewest                           // Drop the record being logged
+	OverflowDropOldest                           // Drop the oldest record in the queue
+	OverflowDropBelowLevel                       // Drop the record being logged if below DropLevel, otherwise block
+)
+
+// Default async queue size
+const defaultAsyncQueueSize = 1024
+
+// Async writing conf
+type AsyncConf struct {
+	QueueSize int            // Bounded queue size, defaultAsyncQueueSize if not set
+	Overflow  OverflowPolicy // Policy when the queue is full
+	DropLevel LogLevel       // Records below this level are dropped when the queue is full, for OverflowDropBelowLevel
+}
+
+// Async writing counters
+type AsyncStats struct {
+	Enqueued uint64 // Records enqueued
+	Written  uint64 // Records written by the background goroutine
+	Dropped  uint64 // Records dropped by the overflow policy
+}
+
+// asyncQueue bounded ring buffer of records, flushed by a dedicated goroutine
+type asyncQueue struct {
+	conf     AsyncConf
+	mu       sync.Mutex
+	notEmpty *sync.Cond
+	notFull  *sync.Cond
+	idle     *sync.Cond // All records written
+	ring     []Record
+	head     int  // Index of the oldest record
+	count    int  // Records in the ring
+	inflight int  // Records being written by the background goroutine
+	closed   bool // Whether closed, records left are still written
+	done     chan struct{}
+	stats    AsyncStats
+}
+
+func newAsyncQueue(conf AsyncConf) *asyncQueue {
+	if conf.QueueSize <= 0 {
+		conf.QueueSize = defaultAsyncQueueSize
+	}
+	q := &asyncQueue{
+		conf: conf,
+		ring: make([]Record, conf.QueueSize),
+		done: make(chan struct{}),
+	}
+	q.notEmpty = sync.NewCond(&q.mu)
+	q.notFull = sync.NewCond(&q.mu)
+	q.idle = sync.NewCond(&q.mu)
+	return q
+}
+
+// enqueue add the record to the queue, apply the overflow policy if full
+func (q *asyncQueue) enqueue(r Record) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for q.count == len(q.ring) && !q.closed {
+		switch q.conf.Overflow {
+		case OverflowDropNewest:
+			q.stats.Dropped++
+			return nil
+		case OverflowDropOldest:
+			q.ring[q.head] = Record{}
+			q.head = (q.head + 1) % len(q.ring)
+			q.count--
+			q.stats.Dropped++
+		case OverflowDropBelowLevel:
+			if r.Level < q.conf.DropLevel {
+				q.stats.Dropped++
+				return nil
+			}
+			q.notFull.Wait()
+		default:
+			q.notFull.Wait()
+		}
+	}
+	if q.closed {
+		return ErrClosed
+	}
+	q.ring[(q.head+q.count)%len(q.ring)] = r
+	q.count++
+	q.stats.Enqueued++
+	q.notEmpty.Signal()
+	return nil
+}
+
+// dequeueAll move all queued records to batch, wait until there is any.
+// Returns empty batch if closed and all written.
+func (q *asyncQueue) dequeueAll(batch []Record) []Record {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for q.count == 0 && !q.closed {
+		q.notEmpty.Wait()
+	}
+	q.inflight = q.count
+	for ; q.count > 0; q.count-- {
+		batch = append(batch, q.ring[q.head])
+		q.ring[q.head] = Record{}
+		q.head = (q.head + 1) % len(q.ring)
+	}
+	q.notFull.Broadcast()
+	return batch
+}
+
+// run write queued records by write, until closed
+func (q *asyncQueue) run(write func(r *Record) error) {
+	defer close(q.done)
+	batch := make([]Record, 0, len(q.ring))
+	for {
+		batch = q.dequeueAll(batch[:0])
+		if len(batch) == 0 {
+			return
+		}
+		for i := range batch {
+			write(&batch[i])
+			batch[i] = Record{}
+		}
+		q.mu.Lock()
+		q.stats.Written += uint64(len(batch))
+		q.inflight = 0
+		if q.count == 0 {
+			q.idle.Broadcast()
+		}
+		q.mu.Unlock()
+	}
+}
+
+// flush wait until all queued records written
+func (q *asyncQueue) flush() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for q.count > 0 || q.inflight > 0 {
+		q.idle.Wait()
+	}
+}
+
+// close stop accepting records, and wait until the queued records written
+func (q *asyncQueue) close() {
+	q.mu.Lock()
+	if !q.closed {
+		q.closed = true
+		q.notEmpty.Broadcast()
+		q.notFull.Broadcast()
+	}
+	q.mu.Unlock()
+	<-q.done
+}
+
+// Stats counters of the queue
+func (q *asyncQueue) Stats() AsyncStats {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.stats
+}
+
+// EnableAsync write records in a background goroutine through a bounded queue,
+// so logging doesn't stall on disk I/O. Call it once before logging.
+func (l *PLogger) EnableAsync(conf AsyncConf) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.async != nil {
+		return
+	}
+	l.async = newAsyncQueue(conf)
+	go l.async.run(func(r *Record) error {
+		l.appendMu.RLock()
+		err := appendRecord(l.appendersWithAncestors(), r)
+		l.appendMu.RUnlock()
+		if err != nil {
+			l.reportError(err)
+		}
+		return err
+	})
+}
+
+// AsyncStats counters of async writing, zero if async not enabled
+func (l *PLogger) AsyncStats() AsyncStats {
+	l.mu.Lock()
+	q := l.async
+	l.mu.Unlock()
+	if q == nil {
+		return AsyncStats{}
+	}
+	return q.Stats()
+}
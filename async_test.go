@@ -0,0 +1,118 @@
+package p_log4go
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// gateWriter blocks the first write until released, to fill the async queue
+type gateWriter struct {
+	mu      sync.Mutex
+	buf     bytes.Buffer
+	entered chan struct{}
+	release chan struct{}
+	once    sync.Once
+}
+
+func newGateWriter() *gateWriter {
+	return &gateWriter{entered: make(chan struct{}), release: make(chan struct{})}
+}
+
+func (w *gateWriter) Write(p []byte) (int, error) {
+	w.once.Do(func() {
+		close(w.entered)
+		<-w.release
+	})
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.buf.Write(p)
+}
+
+func (w *gateWriter) String() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.buf.String()
+}
+
+// testAsyncOverflow log A (blocked in writing), fill the queue of 2 with B and C, then log D and E on overflow
+func testAsyncOverflow(t *testing.T, conf AsyncConf, levelOfDE LogLevel) (string, AsyncStats) {
+	w := newGateWriter()
+	asyncLogger := &PLogger{logLevel: DEBUG, out: w}
+	conf.QueueSize = 2
+	asyncLogger.EnableAsync(conf)
+
+	asyncLogger.Info("A")
+	<-w.entered
+	asyncLogger.Info("B")
+	asyncLogger.Info("C")
+	go func() {
+		// Block policy is released only after the writer goes on
+		asyncLogger.Output(2, levelOfDE, "D")
+		asyncLogger.Output(2, levelOfDE, "E")
+	}()
+	blocking := conf.Overflow == OverflowBlock || (conf.Overflow == OverflowDropBelowLevel && levelOfDE >= conf.DropLevel)
+	if !blocking {
+		waitFor(t, 5*time.Second, func() bool {
+			stats := asyncLogger.AsyncStats()
+			return stats.Enqueued+stats.Dropped >= 5
+		})
+	}
+	close(w.release)
+
+	waitFor(t, 5*time.Second, func() bool {
+		stats := asyncLogger.AsyncStats()
+		return stats.Written+stats.Dropped == 5
+	})
+	return strings.Replace(w.String(), "\n", "", -1), asyncLogger.AsyncStats()
+}
+
+func TestAsyncOverflowPolicy(t *testing.T) {
+	tests := []struct {
+		name      string
+		conf      AsyncConf
+		levelOfDE LogLevel
+		want      string
+		dropped   uint64
+	}{
+		{"Block", AsyncConf{Overflow: OverflowBlock}, INFO, "[INFO] A[INFO] B[INFO] C[INFO] D[INFO] E", 0},
+		{"DropNewest", AsyncConf{Overflow: OverflowDropNewest}, INFO, "[INFO] A[INFO] B[INFO] C", 2},
+		{"DropOldest", AsyncConf{Overflow: OverflowDropOldest}, INFO, "[INFO] A[INFO] D[INFO] E", 2},
+		{"DropBelowLevel", AsyncConf{Overflow: OverflowDropBelowLevel, DropLevel: WARN}, INFO, "[INFO] A[INFO] B[INFO] C", 2},
+		{"KeepAboveLevel", AsyncConf{Overflow: OverflowDropBelowLevel, DropLevel: WARN}, ERROR, "[INFO] A[INFO] B[INFO] C[ERROR] D[ERROR] E", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, stats := testAsyncOverflow(t, tt.conf, tt.levelOfDE)
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+			if stats.Dropped != tt.dropped {
+				t.Errorf("got dropped %d, want %d", stats.Dropped, tt.dropped)
+			}
+		})
+	}
+}
+
+func TestAsyncWrite(t *testing.T) {
+	var buf bytes.Buffer
+	asyncLogger := &PLogger{logLevel: DEBUG, out: &buf, flag: Lshortfile}
+	asyncLogger.EnableAsync(AsyncConf{})
+	for i := 0; i < 100; i++ {
+		asyncLogger.Debug("DEBUG. Line %02d should be written in background.", i)
+	}
+	waitFor(t, 5*time.Second, func() bool {
+		return asyncLogger.AsyncStats().Written == 100
+	})
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 100 {
+		t.Fatalf("got %d lines, want 100", len(lines))
+	}
+	// Caller is resolved before enqueueing
+	if !strings.HasPrefix(lines[99], "[DEBUG] async_test.go:") || !strings.HasSuffix(lines[99], "Line 99 should be written in background.") {
+		t.Errorf("unexpected line %q", lines[99])
+	}
+}
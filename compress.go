@@ -0,0 +1,152 @@
+package p_log4go
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+)
+
+// ======== ======== PLogger: Rotated archives compression ======== ========
+
+// Compressor compresses rotated archives in background.
+// Gzip is built in, others such as zstd can be plugged in by implementing it, e.g.
+//
+//	type zstdCompressor struct{}
+//	func (zstdCompressor) Extension() string { return ".zst" }
+//	func (zstdCompressor) NewWriter(w io.Writer) (io.WriteCloser, error) { return zstd.NewWriter(w) }
+type Compressor interface {
+	Extension() string                             // Compressed file name extension, e.g. ".gz"
+	NewWriter(w io.Writer) (io.WriteCloser, error) // Writer compressing to w
+}
+
+// GzipCompressor compress archives to app.log.2021-06-13.gz
+var GzipCompressor Compressor = gzipCompressor{}
+
+type gzipCompressor struct{}
+
+func (gzipCompressor) Extension() string {
+	return ".gz"
+}
+
+func (gzipCompressor) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	return gzip.NewWriter(w), nil
+}
+
+// compressedExt extension of compressed archives
+func (w *timedRotatingWriter) compressedExt() string {
+	if w.compressor == nil {
+		return GzipCompressor.Extension()
+	}
+	return w.compressor.Extension()
+}
+
+// mill notify the mill goroutine to compress and cleanup archives, never blocks
+func (w *timedRotatingWriter) mill() {
+	select {
+	case w.millCh <- struct{}{}:
+	default:
+	}
+}
+
+// millRun compress archives and then cleanup, until millCh closed
+func (w *timedRotatingWriter) millRun() {
+	defer close(w.millDone)
+	for range w.millCh {
+		// Other processes sharing the file mill the same archives
+		unlock := w.lockRotate()
+		if err := w.compressArchives(); err != nil {
+			reportError(rotateFailure, fmt.Errorf("compress archives error, file: %s: err: %v", w.filename, err))
+		}
+		if err := w.cleanup(); err != nil {
+			reportError(rotateFailure, fmt.Errorf("cleanup archives error, file: %s: err: %v", w.filename, err))
+		}
+		unlock()
+	}
+}
+
+// compressArchives compress all uncompressed archives, including those left by a crash
+func (w *timedRotatingWriter) compressArchives() error {
+	archives, err := w.listArchives()
+	if err != nil {
+		return err
+	}
+	for _, archive := range archives {
+		if archive.compressed {
+			continue
+		}
+		src := archive.path
+		if dstInfo, statErr := os.Stat(src + w.compressor.Extension()); statErr == nil && !dstInfo.ModTime().Equal(archive.modTime) {
+			// Another archive compressed to the same name, number this one rather than overwrite it
+			src = w.nextArchiveName(archive.time)
+			if err = os.Rename(archive.path, src); err != nil {
+				return err
+			}
+		}
+		if err = w.compressFile(src); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// compressFile compress src to a temp file, then rename it to the compressed name and remove src.
+// If crashed in the middle, src is still there and will be compressed again next time.
+func (w *timedRotatingWriter) compressFile(src string) (err error) {
+	srcInfo, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	dst := src + w.compressor.Extension()
+	if dstInfo, err := os.Stat(dst); err == nil {
+		if dstInfo.ModTime().Equal(srcInfo.ModTime()) {
+			// Compressed but crashed before removing src
+			return os.Remove(src)
+		}
+		// Never overwrite another archive
+		return fmt.Errorf("compressed archive %s already exists", dst)
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	tmp := dst + ".tmp"
+	out, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, srcInfo.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			out.Close()
+			os.Remove(tmp)
+		}
+	}()
+
+	cw, err := w.compressor.NewWriter(out)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(cw, in); err != nil {
+		return err
+	}
+	if err = cw.Close(); err != nil {
+		return err
+	}
+	if err = out.Sync(); err != nil {
+		return err
+	}
+	if err = out.Close(); err != nil {
+		return err
+	}
+	// Keep mod time of src, used by max age retention and crash recovery
+	if err = os.Chtimes(tmp, srcInfo.ModTime(), srcInfo.ModTime()); err != nil {
+		return err
+	}
+	if err = os.Rename(tmp, dst); err != nil {
+		return err
+	}
+	return os.Remove(src)
+}
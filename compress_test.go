@@ -0,0 +1,155 @@
+package p_log4go
+
+import (
+	"bufio"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// waitFor poll until cond is true or timeout
+func waitFor(t *testing.T, timeout time.Duration, cond func() bool) {
+	deadline := time.Now().Add(timeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timeout waiting for condition")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// gzipLines count lines of a gzip file
+func gzipLines(t *testing.T, path string) int {
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := 0
+	scanner := bufio.NewScanner(gr)
+	for scanner.Scan() {
+		lines++
+	}
+	return lines
+}
+
+func TestCompressArchives(t *testing.T) {
+	dir, err := ioutil.TempDir("", "plog4go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	logPath := filepath.Join(dir, "gzip.log")
+	gzipLogger, err := GetLogger3(logPath, INFO, RotateConf{Interval: Daily, Rotate: 10, MaxBytes: 256, Compressor: GzipCompressor}, false, FileAppender)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 20; i++ {
+		gzipLogger.Info("INFO. Line %02d should be compressed.", i)
+	}
+
+	// All archives compressed in background, and no plain archive or temp file left
+	waitFor(t, 5*time.Second, func() bool {
+		plain, _ := filepath.Glob(logPath + ".*[0-9]")
+		return len(plain) == 0
+	})
+	compressed, _ := filepath.Glob(logPath + ".*.gz")
+	if len(compressed) < 3 {
+		t.Fatalf("got %d compressed archives, want at least 3", len(compressed))
+	}
+	if tmp, _ := filepath.Glob(logPath + ".*.tmp"); len(tmp) != 0 {
+		t.Errorf("temp files left: %v", tmp)
+	}
+	live, _ := ioutil.ReadFile(logPath)
+	lines := strings.Count(string(live), "\n")
+	for _, archive := range compressed {
+		lines += gzipLines(t, archive)
+	}
+	if lines != 20 {
+		t.Errorf("got %d lines, want 20", lines)
+	}
+}
+
+func TestCompressResumeAfterCrash(t *testing.T) {
+	dir, err := ioutil.TempDir("", "plog4go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	logPath := filepath.Join(dir, "crash.log")
+	format := "2006-01-02"
+	day1 := time.Now().AddDate(0, 0, -1).Format(format)
+	day2 := time.Now().AddDate(0, 0, -2).Format(format)
+	// day1: crashed in the middle of compressing, a partial temp file left
+	// day2: crashed after compressed but before removing the source
+	touchArchives(t, logPath, format, day1, day2)
+	ioutil.WriteFile(logPath+"."+day1+".gz.tmp", []byte("partial"), 0644)
+	day2Info, _ := os.Stat(logPath + "." + day2)
+	crashed := &timedRotatingWriter{compressor: GzipCompressor}
+	if err = crashed.compressFile(logPath + "." + day2); err != nil {
+		t.Fatal(err)
+	}
+	touchArchives(t, logPath, format, day2)
+	os.Chtimes(logPath+"."+day2, day2Info.ModTime(), day2Info.ModTime())
+
+	if _, err = newTimedRotateWriter(logPath, RotateConf{Interval: Daily, Rotate: 3, Compressor: GzipCompressor}); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, 5*time.Second, func() bool {
+		plain, _ := filepath.Glob(logPath + ".*[0-9]")
+		return len(plain) == 0
+	})
+	assertExists(t, logPath, true, "."+day1+".gz", "."+day2+".gz")
+	assertExists(t, logPath, false, "."+day1+".gz.tmp")
+	if lines := gzipLines(t, logPath+"."+day1+".gz"); lines != 1 {
+		t.Errorf("got %d lines, want 1", lines)
+	}
+}
+
+// TestCompressNameTaken another archive of the same name compressed already, e.g. the local hour repeated when DST ended
+func TestCompressNameTaken(t *testing.T) {
+	dir, err := ioutil.TempDir("", "plog4go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	logPath := filepath.Join(dir, "taken.log")
+	format := "2006-01-02"
+	day1 := time.Now().AddDate(0, 0, -1).Format(format)
+	touchArchives(t, logPath, format, day1)
+	first := &timedRotatingWriter{compressor: GzipCompressor}
+	if err = first.compressFile(logPath + "." + day1); err != nil {
+		t.Fatal(err)
+	}
+	touchArchives(t, logPath, format, day1)
+	later := time.Now().Add(time.Hour)
+	os.Chtimes(logPath+"."+day1, later, later)
+	if err = first.compressFile(logPath + "." + day1); err == nil {
+		t.Errorf("got nil error compressing to a taken name, want error")
+	}
+
+	w, err := newTimedRotateWriter(logPath, RotateConf{Interval: Daily, Rotate: 3, Compressor: GzipCompressor})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	waitFor(t, 5*time.Second, func() bool {
+		plain, _ := filepath.Glob(logPath + ".*[0-9]")
+		return len(plain) == 0
+	})
+	assertExists(t, logPath, true, "."+day1+".gz", "."+day1+".1.gz")
+	if lines := gzipLines(t, logPath+"."+day1+".gz") + gzipLines(t, logPath+"."+day1+".1.gz"); lines != 2 {
+		t.Errorf("got %d lines, want 2", lines)
+	}
+}
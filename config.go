@@ -0,0 +1,840 @@
+package p_log4go
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v2"
+)
+
+// ======== ======== PLogger: Configuration ======== ========
+
+// Config declarative config of loggers and appenders, log4j2 style, in JSON, YAML or TOML with the same keys, e.g. in JSON
+//
+//	{
+//	  "appenders": {
+//	    "file": {"type": "file", "path": "./logs/app.log", "format": "json",
+//	             "rotate": {"interval": "Daily", "count": 7, "maxBytes": 104857600, "compress": "gzip"}},
+//	    "console": {"type": "console", "level": "WARN", "pattern": "%d{HH:mm:ss} %-5p %c - %m%n"}
+//	  },
+//	  "loggers": {
+//	    "root": {"level": "INFO", "appenders": ["file", "console"]},
+//	    "com.app.db": {"level": "DEBUG"}
+//	  }
+//	}
+type Config struct {
+	Appenders map[string]AppenderConfig `json:"appenders" yaml:"appenders" toml:"appenders"`
+	Loggers   map[string]LoggerConfig   `json:"loggers" yaml:"loggers" toml:"loggers"` // By dotted name, root is the root logger
+}
+
+// LoggerConfig config of a named logger
+type LoggerConfig struct {
+	Level      string   `json:"level" yaml:"level" toml:"level"`                // Level, inherited from the parent if empty. TRACE starts trace too
+	Trace      *bool    `json:"trace" yaml:"trace" toml:"trace"`                // Whether trace is on, unchanged if not set
+	Additivity *bool    `json:"additivity" yaml:"additivity" toml:"additivity"` // Whether appended to the ancestors' appenders, true if not set
+	Appenders  []string `json:"appenders" yaml:"appenders" toml:"appenders"`    // Names of the appenders
+}
+
+// AppenderConfig config of an appender, by its type
+type AppenderConfig struct {
+	Type    string `json:"type" yaml:"type" toml:"type"`          // file, console, syslog, net or http
+	Level   string `json:"level" yaml:"level" toml:"level"`       // Min level appended, all if empty
+	Format  string `json:"format" yaml:"format" toml:"format"`    // text, json or pattern. The logger formatter if empty, pattern if Pattern set
+	Pattern string `json:"pattern" yaml:"pattern" toml:"pattern"` // Layout of pattern format, e.g. %d %-5p %c - %m%n
+	Flags   string `json:"flags" yaml:"flags" toml:"flags"`       // Flag bits of text and json formats, date|time|microseconds|shortfile by default. Also longfile, utc, msgprefix. Text format if format not set
+
+	// file
+	Path   string       `json:"path" yaml:"path" toml:"path"`
+	Rotate RotateConfig `json:"rotate" yaml:"rotate" toml:"rotate"`
+
+	// console
+	Color       string `json:"color" yaml:"color" toml:"color"`                   // auto, always or never
+	StderrLevel string `json:"stderrLevel" yaml:"stderrLevel" toml:"stderrLevel"` // Records at or above the level go to stderr
+
+	// syslog and net
+	Network string `json:"network" yaml:"network" toml:"network"` // udp, tcp or unixgram
+	Addr    string `json:"addr" yaml:"addr" toml:"addr"`
+
+	// syslog
+	Facility     string `json:"facility" yaml:"facility" toml:"facility"`             // user, daemon, local0 ~ local7
+	SyslogFormat string `json:"syslogFormat" yaml:"syslogFormat" toml:"syslogFormat"` // rfc5424 or rfc3164
+	AppName      string `json:"appName" yaml:"appName" toml:"appName"`
+
+	// net
+	Framing   string       `json:"framing" yaml:"framing" toml:"framing"` // newline or length
+	SpoolPath string       `json:"spoolPath" yaml:"spoolPath" toml:"spoolPath"`
+	Spool     RotateConfig `json:"spool" yaml:"spool" toml:"spool"`
+
+	// http
+	URL        string            `json:"url" yaml:"url" toml:"url"`
+	Encoder    string            `json:"encoder" yaml:"encoder" toml:"encoder"` // json, elasticsearch or loki
+	Index      string            `json:"index" yaml:"index" toml:"index"`       // Elasticsearch index
+	Labels     map[string]string `json:"labels" yaml:"labels" toml:"labels"`    // Loki stream labels
+	Gzip       bool              `json:"gzip" yaml:"gzip" toml:"gzip"`
+	BatchCount int               `json:"batchCount" yaml:"batchCount" toml:"batchCount"`
+	BatchWait  string            `json:"batchWait" yaml:"batchWait" toml:"batchWait"` // Duration, e.g. 1s
+}
+
+// RotateConfig config of file rotating and retention, see RotateConf
+type RotateConfig struct {
+	Interval      string `json:"interval" yaml:"interval" toml:"interval"` // Hourly, Daily or Weekly. Daily by default
+	Count         int64  `json:"count" yaml:"count" toml:"count"`          // Rotated periods kept
+	MaxBytes      int64  `json:"maxBytes" yaml:"maxBytes" toml:"maxBytes"`
+	MaxAge        string `json:"maxAge" yaml:"maxAge" toml:"maxAge"` // Duration, e.g. 168h
+	MaxTotalBytes int64  `json:"maxTotalBytes" yaml:"maxTotalBytes" toml:"maxTotalBytes"`
+	Compress      string `json:"compress" yaml:"compress" toml:"compress"` // gzip, or empty for no compression
+	Location      string `json:"location" yaml:"location" toml:"location"` // IANA zone rotating by, e.g. Asia/Shanghai. Local by default
+}
+
+// configFormats unmarshal funcs of config files by extension
+var configFormats = struct {
+	sync.Mutex
+	unmarshal map[string]func(data []byte, v interface{}) error
+}{unmarshal: map[string]func([]byte, interface{}) error{
+	".json": json.Unmarshal,
+	".yaml": yaml.Unmarshal,
+	".yml":  yaml.Unmarshal,
+	".toml": toml.Unmarshal,
+}}
+
+// RegisterConfigFormat register the unmarshal func of config files with the extension.
+// JSON, YAML (.yaml, .yml) and TOML are built in, register others or replace them, e.g.
+//
+//	RegisterConfigFormat(".hcl", hcl.Unmarshal)
+func RegisterConfigFormat(ext string, unmarshal func(data []byte, v interface{}) error) {
+	configFormats.Lock()
+	defer configFormats.Unlock()
+	configFormats.unmarshal[strings.ToLower(ext)] = unmarshal
+}
+
+// ParseConfig parse the config file by its extension
+func ParseConfig(path string) (*Config, error) {
+	ext := strings.ToLower(filepath.Ext(path))
+	configFormats.Lock()
+	unmarshal := configFormats.unmarshal[ext]
+	configFormats.Unlock()
+	if unmarshal == nil {
+		return nil, fmt.Errorf("config %s: no format registered for %q, register it by RegisterConfigFormat", path, ext)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("config %s: %v", path, err)
+	}
+	config := &Config{}
+	if err = unmarshal(data, config); err != nil {
+		return nil, fmt.Errorf("config %s: %v", path, err)
+	}
+	return config, nil
+}
+
+// ConfigError problems found validating a config
+type ConfigError struct {
+	Problems []string // e.g. appenders.file: path not set
+}
+
+func (e *ConfigError) Error() string {
+	return "invalid log config: " + strings.Join(e.Problems, "; ")
+}
+
+// Validate check the config, returns *ConfigError listing all the problems
+func (c *Config) Validate() error {
+	var problems []string
+	addProblem := func(format string, v ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, v...))
+	}
+
+	for _, name := range sortedKeys(c.Appenders) {
+		ac := c.Appenders[name]
+		at := "appenders." + name
+		if _, err := ac.formatter(); err != nil {
+			addProblem("%s: %v", at, err)
+		}
+		if ac.Level != "" {
+			if _, err := ParseLevel(ac.Level); err != nil {
+				addProblem("%s: %v", at, err)
+			}
+		}
+		switch ac.Type {
+		case "file":
+			if ac.Path == "" {
+				addProblem("%s: path not set", at)
+			}
+			if _, err := ac.Rotate.rotateConf(); err != nil {
+				addProblem("%s.rotate: %v", at, err)
+			}
+		case "console":
+			if _, err := ac.consoleConf(); err != nil {
+				addProblem("%s: %v", at, err)
+			}
+		case "syslog":
+			if _, err := ac.syslogConf(); err != nil {
+				addProblem("%s: %v", at, err)
+			}
+		case "net":
+			if _, err := ac.netConf(); err != nil {
+				addProblem("%s: %v", at, err)
+			}
+		case "http":
+			if _, err := ac.httpConf(); err != nil {
+				addProblem("%s: %v", at, err)
+			}
+		case "":
+			addProblem("%s: type not set, must be one of file, console, syslog, net, http", at)
+		default:
+			addProblem("%s: unknown type %q, must be one of file, console, syslog, net, http", at, ac.Type)
+		}
+	}
+
+	for _, name := range sortedKeys(c.Loggers) {
+		lc := c.Loggers[name]
+		at := "loggers." + name
+		if lc.Level != "" {
+			if _, err := ParseLevel(lc.Level); err != nil {
+				addProblem("%s: %v", at, err)
+			}
+		}
+		for _, appender := range lc.Appenders {
+			if _, ok := c.Appenders[appender]; !ok {
+				addProblem("%s: appender %q not defined", at, appender)
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		return &ConfigError{Problems: problems}
+	}
+	return nil
+}
+
+// sortedKeys keys of the map sorted, for stable problems order
+func sortedKeys(m interface{}) []string {
+	var keys []string
+	switch m := m.(type) {
+	case map[string]AppenderConfig:
+		for k := range m {
+			keys = append(keys, k)
+		}
+	case map[string]LoggerConfig:
+		for k := range m {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// configFlags flag bits by name
+var configFlags = map[string]int{
+	"date":         Ldate,
+	"time":         Ltime,
+	"microseconds": Lmicroseconds,
+	"longfile":     Llongfile,
+	"shortfile":    Lshortfile,
+	"utc":          LUTC,
+	"msgprefix":    Lmsgprefix,
+}
+
+// formatter of the appender, nil means the logger formatter
+func (ac *AppenderConfig) formatter() (Formatter, error) {
+	flag := Ldate | Ltime | Lmicroseconds | Lshortfile
+	if ac.Flags != "" {
+		flag = 0
+		for _, name := range strings.Split(ac.Flags, "|") {
+			bit, ok := configFlags[strings.ToLower(strings.TrimSpace(name))]
+			if !ok {
+				return nil, fmt.Errorf("unknown flag %q, must be of date, time, microseconds, longfile, shortfile, utc, msgprefix", name)
+			}
+			flag |= bit
+		}
+	}
+	format := ac.Format
+	if format == "" && ac.Pattern != "" {
+		format = "pattern"
+	}
+	switch format {
+	case "":
+		if ac.Flags == "" {
+			return nil, nil
+		}
+		// Flags alone are of the default text format
+		return &TextFormatter{Flag: flag}, nil
+	case "text":
+		return &TextFormatter{Flag: flag}, nil
+	case "json":
+		return &JSONFormatter{Flag: flag}, nil
+	case "pattern":
+		if ac.Pattern == "" {
+			return nil, fmt.Errorf("pattern not set")
+		}
+		if ac.Flags != "" {
+			return nil, fmt.Errorf("flags not applicable to the pattern format")
+		}
+		return NewPatternLayout(ac.Pattern)
+	}
+	return nil, fmt.Errorf("unknown format %q, must be one of text, json, pattern", ac.Format)
+}
+
+// rotateConf rotate conf of the file appender
+func (rc *RotateConfig) rotateConf() (RotateConf, error) {
+	conf := RotateConf{Interval: Daily, Rotate: rc.Count, MaxBytes: rc.MaxBytes, MaxTotalBytes: rc.MaxTotalBytes}
+	if conf.Rotate == 0 {
+		conf.Rotate = defaultRotateCount
+	}
+	switch strings.ToLower(rc.Interval) {
+	case "":
+	case "hourly":
+		conf.Interval = Hourly
+	case "daily":
+		conf.Interval = Daily
+	case "weekly":
+		conf.Interval = Weekly
+	default:
+		return conf, fmt.Errorf("unknown interval %q, must be one of Hourly, Daily, Weekly", rc.Interval)
+	}
+	if rc.Count < 0 || rc.MaxBytes < 0 || rc.MaxTotalBytes < 0 {
+		return conf, fmt.Errorf("count, maxBytes and maxTotalBytes must not be negative")
+	}
+	if rc.MaxAge != "" {
+		maxAge, err := time.ParseDuration(rc.MaxAge)
+		if err != nil {
+			return conf, fmt.Errorf("maxAge: %v", err)
+		}
+		conf.MaxAge = maxAge
+	}
+	if rc.Location != "" {
+		location, err := time.LoadLocation(rc.Location)
+		if err != nil {
+			return conf, fmt.Errorf("location: %v", err)
+		}
+		conf.Location = location
+	}
+	switch strings.ToLower(rc.Compress) {
+	case "":
+	case "gzip":
+		conf.Compressor = GzipCompressor
+	default:
+		return conf, fmt.Errorf("unknown compress %q, must be gzip", rc.Compress)
+	}
+	return conf, nil
+}
+
+func (ac *AppenderConfig) consoleConf() (ConsoleConf, error) {
+	var conf ConsoleConf
+	switch strings.ToLower(ac.Color) {
+	case "", "auto":
+		conf.Color = ColorAuto
+	case "always":
+		conf.Color = ColorAlways
+	case "never":
+		conf.Color = ColorNever
+	default:
+		return conf, fmt.Errorf("unknown color %q, must be one of auto, always, never", ac.Color)
+	}
+	if ac.StderrLevel != "" {
+		level, err := ParseLevel(ac.StderrLevel)
+		if err != nil {
+			return conf, fmt.Errorf("stderrLevel: %v", err)
+		}
+		conf.SplitStderr, conf.StderrLevel = true, level
+	}
+	return conf, nil
+}
+
+// syslogFacilities facilities by name
+var syslogFacilities = map[string]SyslogFacility{
+	"user": USER, "daemon": DAEMON,
+	"local0": LOCAL0, "local1": LOCAL1, "local2": LOCAL2, "local3": LOCAL3,
+	"local4": LOCAL4, "local5": LOCAL5, "local6": LOCAL6, "local7": LOCAL7,
+}
+
+func (ac *AppenderConfig) syslogConf() (SyslogConf, error) {
+	conf := SyslogConf{Network: ac.Network, Addr: ac.Addr, AppName: ac.AppName}
+	if ac.Network != "" && ac.Network != "udp" && ac.Network != "tcp" && ac.Network != "unixgram" {
+		return conf, fmt.Errorf("unknown network %q, must be one of udp, tcp, unixgram, or empty for the local syslog", ac.Network)
+	}
+	if ac.Network != "" && ac.Addr == "" {
+		return conf, fmt.Errorf("addr not set")
+	}
+	if ac.Facility != "" {
+		facility, ok := syslogFacilities[strings.ToLower(ac.Facility)]
+		if !ok {
+			return conf, fmt.Errorf("unknown facility %q, must be one of user, daemon, local0 ~ local7", ac.Facility)
+		}
+		conf.Facility = facility
+	}
+	switch strings.ToLower(ac.SyslogFormat) {
+	case "", "rfc5424":
+		conf.Format = RFC5424
+	case "rfc3164":
+		conf.Format = RFC3164
+	default:
+		return conf, fmt.Errorf("unknown syslogFormat %q, must be one of rfc5424, rfc3164", ac.SyslogFormat)
+	}
+	return conf, nil
+}
+
+func (ac *AppenderConfig) netConf() (NetConf, error) {
+	conf := NetConf{Network: ac.Network, Addr: ac.Addr, SpoolPath: ac.SpoolPath}
+	if ac.Network != "tcp" && ac.Network != "udp" {
+		return conf, fmt.Errorf("unknown network %q, must be one of tcp, udp", ac.Network)
+	}
+	if ac.Addr == "" {
+		return conf, fmt.Errorf("addr not set")
+	}
+	switch strings.ToLower(ac.Framing) {
+	case "", "newline":
+		conf.Framing = NewlineFraming
+	case "length":
+		conf.Framing = LengthPrefixFraming
+	default:
+		return conf, fmt.Errorf("unknown framing %q, must be one of newline, length", ac.Framing)
+	}
+	spool, err := ac.Spool.rotateConf()
+	if err != nil {
+		return conf, fmt.Errorf("spool: %v", err)
+	}
+	conf.SpoolRotate = spool
+	return conf, nil
+}
+
+func (ac *AppenderConfig) httpConf() (HTTPConf, error) {
+	conf := HTTPConf{URL: ac.URL, Gzip: ac.Gzip, BatchCount: ac.BatchCount}
+	if ac.URL == "" {
+		return conf, fmt.Errorf("url not set")
+	}
+	switch strings.ToLower(ac.Encoder) {
+	case "", "json":
+		conf.Encoder = JSONArrayEncoder{}
+	case "elasticsearch":
+		conf.Encoder = ElasticsearchEncoder{Index: ac.Index}
+	case "loki":
+		conf.Encoder = LokiEncoder{Labels: ac.Labels}
+	default:
+		return conf, fmt.Errorf("unknown encoder %q, must be one of json, elasticsearch, loki", ac.Encoder)
+	}
+	if ac.BatchWait != "" {
+		wait, err := time.ParseDuration(ac.BatchWait)
+		if err != nil {
+			return conf, fmt.Errorf("batchWait: %v", err)
+		}
+		conf.BatchWait = wait
+	}
+	return conf, nil
+}
+
+// build the appender of the validated config
+func (ac *AppenderConfig) build() (Appender, error) {
+	var appender Appender
+	var err error
+	switch ac.Type {
+	case "file":
+		conf, _ := ac.Rotate.rotateConf()
+		appender, err = NewFileAppender(ac.Path, conf)
+	case "console":
+		conf, _ := ac.consoleConf()
+		appender = NewColorConsoleAppender(conf)
+	case "syslog":
+		conf, _ := ac.syslogConf()
+		appender, err = NewSyslogAppender(conf)
+	case "net":
+		conf, _ := ac.netConf()
+		appender, err = NewNetAppender(conf)
+	case "http":
+		conf, _ := ac.httpConf()
+		appender, err = NewHTTPAppender(conf)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if ac.Level != "" {
+		level, _ := ParseLevel(ac.Level)
+		appender.(interface{ SetLevel(LogLevel) }).SetLevel(level)
+	}
+	if formatter, _ := ac.formatter(); formatter != nil {
+		if fa, ok := appender.(interface{ SetFormatter(Formatter) }); ok {
+			fa.SetFormatter(formatter)
+		}
+	}
+	return appender, nil
+}
+
+// ConfigLoader loads the config file to the named loggers, and reloads it on demand, on SIGHUP or on file change.
+// It owns the appenders it builds: they're attached to the configured loggers, and on reload kept if their config
+// is unchanged, or else detached and closed.
+// Appenders attached in code are kept, except the built-in ones of the root logger, e.g. the default
+// ./logs/app.log file, which are replaced and closed once the config sets appenders of "root".
+type ConfigLoader struct {
+	path string
+	reg  *loggerRegistry
+
+	mu        sync.Mutex                // serializes reloads; protects the following fields
+	appenders map[*PLogger][]Appender   // Appenders built by the loader, by the logger attached to
+	built     map[string]Appender       // Appenders built by the loader, by name
+	configs   map[string]AppenderConfig // Configs of the built appenders, by name
+	loggers   map[string]bool           // Names of the loggers configured
+	stop      chan struct{}             // Closed to stop watching
+	stopped   bool
+	wg        sync.WaitGroup
+}
+
+// LoadConfig load the config file to the named loggers, see GetNamedLogger. The root logger is configured by "root".
+func LoadConfig(path string) (*ConfigLoader, error) {
+	return loadConfig(namedLoggers, path)
+}
+
+func loadConfig(reg *loggerRegistry, path string) (*ConfigLoader, error) {
+	c := &ConfigLoader{path: path, reg: reg, appenders: make(map[*PLogger][]Appender),
+		loggers: make(map[string]bool), stop: make(chan struct{})}
+	if err := c.Reload(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Reload parse, validate and apply the config file. On errors the current config is kept.
+// Records are never lost: the old appenders are closed after the records being appended to them.
+// Appenders with the config unchanged are kept open. A changed one on the same file as before, or the spool,
+// is opened after the old one closed, with appending paused meanwhile. If it fails to open then,
+// the rest of the config is applied and the error returned.
+func (c *ConfigLoader) Reload() error {
+	config, err := ParseConfig(c.path)
+	if err != nil {
+		return err
+	}
+	if err = config.Validate(); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	kept := make(map[string]bool)
+	for name, ac := range config.Appenders {
+		if old, ok := c.configs[name]; ok && reflect.DeepEqual(old, ac) {
+			kept[name] = true
+		}
+	}
+	var closing, replaced []Appender
+	for name, a := range c.built {
+		if !kept[name] {
+			closing = append(closing, a)
+		}
+	}
+	if rc, ok := config.Loggers["root"]; ok && len(rc.Appenders) > 0 {
+		// The configured appenders replace the built-in ones, not to write the same file twice
+		replaced = c.reg.root.builtinAppenders(c.appenders[c.reg.root])
+		closing = append(closing, replaced...)
+	}
+	closingPaths := make(map[string]bool)
+	for _, a := range closing {
+		if path := appenderPath(a); path != "" {
+			closingPaths[path] = true
+		}
+	}
+
+	// Build the appenders first, nothing changes if any fails.
+	// Those on the path of an appender closing are built after it's closed.
+	built := make(map[string]Appender, len(config.Appenders))
+	var deferred []string
+	for _, name := range sortedKeys(config.Appenders) {
+		ac := config.Appenders[name]
+		if kept[name] {
+			built[name] = c.built[name]
+			continue
+		}
+		if closingPaths[ac.filePath()] {
+			deferred = append(deferred, name)
+			continue
+		}
+		appender, err := ac.build()
+		if err != nil {
+			for name, a := range built {
+				if !kept[name] {
+					a.Close()
+				}
+			}
+			return fmt.Errorf("appenders.%s: %v", name, err)
+		}
+		built[name] = appender
+	}
+
+	var buildErr error
+	if len(deferred) == 0 {
+		// Swap each logger's appenders, then close the old ones once no record is being appended to them
+		c.apply(config, built, replaced)
+		c.reg.waitAppending()
+		closeAppenders(closing)
+	} else {
+		// No record is being appended while the files change hands
+		unlock := c.reg.lockAppending()
+		closeAppenders(closing)
+		for _, name := range deferred {
+			ac := config.Appenders[name]
+			appender, err := ac.build()
+			if err != nil {
+				if buildErr == nil {
+					buildErr = fmt.Errorf("appenders.%s: %v", name, err)
+				}
+				continue
+			}
+			built[name] = appender
+		}
+		c.apply(config, built, replaced)
+		unlock()
+	}
+	c.built = built
+	c.configs = make(map[string]AppenderConfig, len(built))
+	for name := range built {
+		c.configs[name] = config.Appenders[name]
+	}
+	return buildErr
+}
+
+// apply the loggers config, each logger's appenders built by the loader replaced by the new ones in one step
+func (c *ConfigLoader) apply(config *Config, built map[string]Appender, replaced []Appender) {
+	old := c.appenders
+	c.appenders = make(map[*PLogger][]Appender)
+	configured := make(map[string]bool)
+	for _, name := range sortedKeys(config.Loggers) {
+		lc := config.Loggers[name]
+		loggerName := name
+		if name == "root" {
+			loggerName = ""
+		}
+		logger := c.reg.get(loggerName)
+		var appenders []Appender
+		for _, name := range lc.Appenders {
+			if a := built[name]; a != nil {
+				appenders = append(appenders, a)
+			}
+		}
+		detached := old[logger]
+		if logger == c.reg.root {
+			detached = append(append([]Appender(nil), detached...), replaced...)
+		}
+		logger.swapAppenders(detached, appenders)
+		logger.SetAdditivity(lc.Additivity == nil || *lc.Additivity)
+		if lc.Trace != nil && *lc.Trace {
+			logger.StartTrace()
+		} else if lc.Trace != nil {
+			logger.StopTrace()
+		}
+		if lc.Level != "" {
+			level, _ := ParseLevel(lc.Level)
+			logger.SetLevel(level)
+			if level == trace {
+				logger.StartTrace()
+			}
+		} else {
+			logger.ResetLevel()
+		}
+		c.appenders[logger] = appenders
+		configured[logger.name] = true
+	}
+	// Loggers no more configured inherit again
+	for name := range c.loggers {
+		if !configured[name] {
+			logger := c.reg.get(name)
+			logger.swapAppenders(old[logger], nil)
+			logger.ResetLevel()
+			logger.ResetTrace()
+			logger.SetAdditivity(true)
+		}
+	}
+	c.loggers = configured
+}
+
+// waitAppending wait for the records being appended by the loggers, to the appenders got before
+func (reg *loggerRegistry) waitAppending() {
+	for _, l := range reg.all() {
+		l.appendMu.Lock()
+		l.appendMu.Unlock()
+	}
+}
+
+// lockAppending wait for the records being appended by the loggers, and hold appending until unlock called
+func (reg *loggerRegistry) lockAppending() (unlock func()) {
+	loggers := reg.all()
+	for _, l := range loggers {
+		l.appendMu.Lock()
+	}
+	return func() {
+		for _, l := range loggers {
+			l.appendMu.Unlock()
+		}
+	}
+}
+
+// closeAppenders close the appenders, errors are reported by the appenders if any
+func closeAppenders(appenders []Appender) {
+	for _, a := range appenders {
+		a.Close()
+	}
+}
+
+// appenderPath absolute path of the file or spool the appender opened, empty if none
+func appenderPath(a Appender) string {
+	var path string
+	switch a := a.(type) {
+	case *WriterAppender:
+		if w, ok := a.w.(*timedRotatingWriter); ok {
+			path = w.filename
+		}
+	case *NetAppender:
+		path = a.conf.SpoolPath
+	}
+	return absPath(path)
+}
+
+// filePath absolute path of the file or spool of the appender config, empty if none
+func (ac *AppenderConfig) filePath() string {
+	switch ac.Type {
+	case "file":
+		return absPath(ac.Path)
+	case "net":
+		return absPath(ac.SpoolPath)
+	}
+	return ""
+}
+
+// absPath absolute and clean path, empty if empty
+func absPath(path string) string {
+	if path == "" {
+		return ""
+	}
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return filepath.Clean(path)
+}
+
+// swapAppenders detach the appenders and attach the others in one step, so no record misses both
+func (l *PLogger) swapAppenders(detached, attached []Appender) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	appenders := make([]Appender, 0, len(l.appenders)+len(attached))
+	for _, a := range l.appendersLocked() {
+		if !containsAppender(detached, a) {
+			appenders = append(appenders, a)
+		}
+	}
+	l.appenders = append(appenders, attached...)
+}
+
+// builtinAppenders the built-in appenders attached, see AppenderFlag, except the loader's own
+func (l *PLogger) builtinAppenders(own []Appender) []Appender {
+	var builtin []Appender
+	for _, a := range l.Appenders() {
+		if fa, ok := a.(flaggedAppender); !ok || fa.appenderFlag() == 0 || containsAppender(own, a) {
+			continue
+		}
+		builtin = append(builtin, a)
+	}
+	return builtin
+}
+
+// containsAppender whether the appender is one of the appenders
+func containsAppender(appenders []Appender, a Appender) bool {
+	for _, b := range appenders {
+		if a == b {
+			return true
+		}
+	}
+	return false
+}
+
+// WatchSignal reload on SIGHUP, until Close
+func (c *ConfigLoader) WatchSignal() {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGHUP)
+	c.watch(func() {
+		signal.Stop(ch)
+	}, func() <-chan struct{} {
+		changed := make(chan struct{})
+		go func() {
+			select {
+			case <-ch:
+				close(changed)
+			case <-c.stop:
+			}
+		}()
+		return changed
+	})
+}
+
+// WatchFile reload when the file changes, polling its mod time and size every interval, until Close
+func (c *ConfigLoader) WatchFile(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	var lastMod time.Time
+	var lastSize int64
+	if info, err := os.Stat(c.path); err == nil {
+		lastMod, lastSize = info.ModTime(), info.Size()
+	}
+	c.watch(ticker.Stop, func() <-chan struct{} {
+		changed := make(chan struct{})
+		go func() {
+			for {
+				select {
+				case <-ticker.C:
+					info, err := os.Stat(c.path)
+					if err != nil || (info.ModTime().Equal(lastMod) && info.Size() == lastSize) {
+						continue
+					}
+					lastMod, lastSize = info.ModTime(), info.Size()
+					close(changed)
+					return
+				case <-c.stop:
+					return
+				}
+			}
+		}()
+		return changed
+	})
+}
+
+// watch reload on each change notified, until Close. Reload errors are reported to the error handler.
+func (c *ConfigLoader) watch(release func(), next func() <-chan struct{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.stopped {
+		release()
+		return
+	}
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		defer release()
+		for {
+			select {
+			case <-next():
+				if err := c.Reload(); err != nil {
+					reportError(internalFailure, fmt.Errorf("reload log config error, keep the current config: %v", err))
+				}
+			case <-c.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Close stop watching. The loggers and appenders configured are kept.
+func (c *ConfigLoader) Close() error {
+	c.mu.Lock()
+	if !c.stopped {
+		c.stopped = true
+		close(c.stop)
+	}
+	c.mu.Unlock()
+	c.wg.Wait()
+	return nil
+}
@@ -0,0 +1,406 @@
+package p_log4go
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestConfigValidate(t *testing.T) {
+	config := &Config{
+		Appenders: map[string]AppenderConfig{
+			"file":    {Type: "file", Rotate: RotateConfig{Interval: "Monthly"}},
+			"zone":    {Type: "file", Path: "zone.log", Rotate: RotateConfig{Location: "Mars/Olympus"}},
+			"console": {Type: "console", Level: "LOUD", Color: "sometimes"},
+			"udp":     {Type: "smoke"},
+			"fmt":     {Type: "console", Format: "xml", Flags: "date|nanoseconds"},
+			"pattern": {Type: "console", Pattern: "%m%n", Flags: "utc"},
+		},
+		Loggers: map[string]LoggerConfig{
+			"root":   {Level: "INFO", Appenders: []string{"console", "missing"}},
+			"com.db": {Level: "CHATTY"},
+		},
+	}
+	err := config.Validate()
+	configErr, ok := err.(*ConfigError)
+	if !ok {
+		t.Fatalf("got err %v, want *ConfigError", err)
+	}
+	wants := []string{
+		`appenders.console: unknown level "LOUD"`,
+		`appenders.console: unknown color "sometimes"`,
+		`appenders.file: path not set`,
+		`appenders.file.rotate: unknown interval "Monthly"`,
+		`appenders.fmt: unknown flag "nanoseconds"`,
+		`appenders.pattern: flags not applicable to the pattern format`,
+		`appenders.udp: unknown type "smoke"`,
+		`appenders.zone.rotate: location: unknown time zone Mars/Olympus`,
+		`loggers.com.db: unknown level "CHATTY"`,
+		`loggers.root: appender "missing" not defined`,
+	}
+	if len(configErr.Problems) != len(wants) {
+		t.Fatalf("got problems %q, want %d", configErr.Problems, len(wants))
+	}
+	for i, want := range wants {
+		if !strings.HasPrefix(configErr.Problems[i], want) {
+			t.Errorf("got problem %q, want %q", configErr.Problems[i], want)
+		}
+	}
+}
+
+func TestConfigFlagsOfDefaultFormat(t *testing.T) {
+	formatter, err := (&AppenderConfig{Type: "console", Flags: "time|utc"}).formatter()
+	if text, ok := formatter.(*TextFormatter); err != nil || !ok || text.Flag != Ltime|LUTC {
+		t.Errorf("got formatter %#v, err %v, want text with time|utc", formatter, err)
+	}
+	if formatter, err = (&AppenderConfig{Type: "console"}).formatter(); formatter != nil || err != nil {
+		t.Errorf("got formatter %#v, err %v, want nil of the logger", formatter, err)
+	}
+}
+
+func TestConfigLoadAndReload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "plog-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "log.json")
+	writeConfig := func(appPath string) {
+		t.Helper()
+		config := `{
+  "appenders": {
+    "app": {"type": "file", "path": "` + appPath + `", "pattern": "%c %p %m%n"}
+  },
+  "loggers": {
+    "root": {"level": "WARN"},
+    "com.app": {"level": "DEBUG", "additivity": false, "appenders": ["app"]}
+  }
+}`
+		if err := ioutil.WriteFile(path, []byte(config), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	first, second := filepath.Join(dir, "first.log"), filepath.Join(dir, "second.log")
+	writeConfig(first)
+
+	var rootOut bytes.Buffer
+	root := &PLogger{logLevel: INFO, out: &rootOut}
+	reg := newLoggerRegistry(root)
+	loader, err := loadConfig(reg, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer loader.Close()
+	db := reg.get("com.app.db")
+	if root.GetLevel() != WARN || db.GetLevel() != DEBUG {
+		t.Errorf("got levels root %v, db %v, want WARN, DEBUG", root.GetLevel(), db.GetLevel())
+	}
+
+	// Reload while logging, no record lost
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 500; i++ {
+			db.Debug("%d", i)
+		}
+	}()
+	writeConfig(second)
+	if err = loader.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	wg.Wait()
+	db.Info("after")
+
+	// Invalid config keeps the current one
+	ioutil.WriteFile(path, []byte(`{"appenders": {"app": {"type": "file"}}}`), 0644)
+	if err = loader.Reload(); err == nil || !strings.Contains(err.Error(), "appenders.app: path not set") {
+		t.Errorf("got reload err %v, want path not set", err)
+	}
+	db.Info("kept")
+	loader.Close()
+	for _, a := range reg.get("com.app").Appenders() {
+		a.Close()
+	}
+
+	var lines []string
+	for _, p := range []string{first, second} {
+		data, err := ioutil.ReadFile(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(data) > 0 {
+			lines = append(lines, strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")...)
+		}
+	}
+	if want := 502; len(lines) != want {
+		t.Fatalf("got %d lines, want %d", len(lines), want)
+	}
+	if tail := strings.Join(lines[500:], "|"); tail != "com.app.db INFO after|com.app.db INFO kept" {
+		t.Errorf("got tail %q", tail)
+	}
+	if rootOut.Len() != 0 {
+		t.Errorf("non additive logger appended to root: %q", rootOut.String())
+	}
+}
+
+// TestConfigReplaceRootAppenders root appenders configured replace the built-in ones of the default logger
+func TestConfigReplaceRootAppenders(t *testing.T) {
+	dir, err := ioutil.TempDir("", "plog-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	appPath := filepath.Join(dir, "app.log")
+
+	// The default logger with its built-in file appender on the same path, restored after
+	builtin, err := NewFileAppender(appPath, RotateConf{Interval: Daily, Rotate: defaultRotateCount})
+	if err != nil {
+		t.Fatal(err)
+	}
+	original := defaultLogger.Appenders()
+	oldLevel := defaultLogger.GetLevel()
+	for _, a := range original {
+		defaultLogger.DetachAppender(a)
+	}
+	defaultLogger.AttachAppender(builtin)
+	defer func() {
+		for _, a := range defaultLogger.Appenders() {
+			defaultLogger.DetachAppender(a)
+			a.Close()
+		}
+		for _, a := range original {
+			defaultLogger.AttachAppender(a)
+		}
+		defaultLogger.SetLevel(oldLevel)
+	}()
+
+	path := filepath.Join(dir, "log.json")
+	config := `{
+  "appenders": {"file": {"type": "file", "path": "` + appPath + `", "pattern": "%p %m%n"}},
+  "loggers": {"root": {"level": "INFO", "appenders": ["file"]}}
+}`
+	if err = ioutil.WriteFile(path, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+	loader, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer loader.Close()
+	if n := len(defaultLogger.Appenders()); n != 1 {
+		t.Errorf("got %d root appenders, want 1", n)
+	}
+	if err = builtin.Append(&Record{Level: INFO}); err != ErrClosed {
+		t.Errorf("got err %v appending to the replaced appender, want ErrClosed", err)
+	}
+	Info("first")
+	if err = loader.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(defaultLogger.Appenders()); n != 1 {
+		t.Errorf("got %d root appenders after reload, want 1", n)
+	}
+	Info("second")
+	defaultLogger.Sync()
+
+	data, err := ioutil.ReadFile(appPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(data); got != "INFO first\nINFO second\n" {
+		t.Errorf("got app.log %q, want each record once", got)
+	}
+}
+
+func TestConfigReloadSamePath(t *testing.T) {
+	dir, err := ioutil.TempDir("", "plog-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "log.json")
+	appPath, keptPath := filepath.Join(dir, "app.log"), filepath.Join(dir, "kept.log")
+	writeConfig := func(pattern string) {
+		t.Helper()
+		config := `{
+  "appenders": {
+    "app": {"type": "file", "path": "` + appPath + `", "pattern": "` + pattern + `"},
+    "kept": {"type": "file", "path": "` + keptPath + `", "pattern": "%m%n"}
+  },
+  "loggers": {"com.app": {"level": "INFO", "additivity": false, "appenders": ["app", "kept"]}}
+}`
+		if err := ioutil.WriteFile(path, []byte(config), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeConfig("%m%n")
+
+	reg := newLoggerRegistry(&PLogger{logLevel: INFO, out: ioutil.Discard})
+	loader, err := loadConfig(reg, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer loader.Close()
+	app := reg.get("com.app")
+	before := app.Appenders()
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 500; i++ {
+			app.Info("%d", i)
+		}
+	}()
+	// Only the app appender changed, closed before opened again on the same file
+	writeConfig("%p %m%n")
+	if err = loader.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	wg.Wait()
+	after := app.Appenders()
+	if len(after) != 2 || after[0] == before[0] || after[1] != before[1] {
+		t.Fatalf("got appenders %v, want kept %v and a new one", after, before[1])
+	}
+	if err = before[0].Append(&Record{Level: INFO}); err != ErrClosed {
+		t.Errorf("got err %v appending to the replaced appender, want ErrClosed", err)
+	}
+	for _, a := range after {
+		a.Close()
+	}
+
+	for _, p := range []string{appPath, keptPath} {
+		data, err := ioutil.ReadFile(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if lines := strings.Count(string(data), "\n"); lines != 500 {
+			t.Errorf("got %d lines in %s, want 500", lines, filepath.Base(p))
+		}
+	}
+}
+
+func TestConfigRegisterFormat(t *testing.T) {
+	dir, err := ioutil.TempDir("", "plog-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "log.conf")
+	ioutil.WriteFile(path, []byte("root=ERROR"), 0644)
+	if _, err = ParseConfig(path); err == nil || !strings.Contains(err.Error(), "no format registered") {
+		t.Errorf("got err %v, want no format registered", err)
+	}
+
+	// A toy key=level format
+	RegisterConfigFormat(".conf", func(data []byte, v interface{}) error {
+		kv := strings.SplitN(string(data), "=", 2)
+		v.(*Config).Loggers = map[string]LoggerConfig{kv[0]: {Level: kv[1]}}
+		return nil
+	})
+	defer func() {
+		configFormats.Lock()
+		delete(configFormats.unmarshal, ".conf")
+		configFormats.Unlock()
+	}()
+	config, err := ParseConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := config.Loggers["root"].Level; got != "ERROR" {
+		t.Errorf("got level %q, want ERROR", got)
+	}
+}
+
+// TestConfigFormats the same config in JSON, YAML and TOML
+func TestConfigFormats(t *testing.T) {
+	dir, err := ioutil.TempDir("", "plog-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"log.json": `{
+  "appenders": {
+    "file": {"type": "file", "path": "./logs/app.log", "format": "json",
+             "rotate": {"interval": "Daily", "count": 7, "maxAge": "168h", "compress": "gzip"}},
+    "loki": {"type": "http", "url": "http://localhost:3100/loki/api/v1/push", "encoder": "loki",
+             "labels": {"app": "demo"}, "gzip": true}
+  },
+  "loggers": {
+    "root": {"level": "INFO", "appenders": ["file"]},
+    "com.app.db": {"level": "DEBUG", "additivity": false, "appenders": ["loki"]}
+  }
+}`,
+		"log.yaml": `
+appenders:
+  file:
+    type: file
+    path: ./logs/app.log
+    format: json
+    rotate: {interval: Daily, count: 7, maxAge: 168h, compress: gzip}
+  loki:
+    type: http
+    url: http://localhost:3100/loki/api/v1/push
+    encoder: loki
+    labels: {app: demo}
+    gzip: true
+loggers:
+  root: {level: INFO, appenders: [file]}
+  com.app.db: {level: DEBUG, additivity: false, appenders: [loki]}
+`,
+		"log.toml": `
+[appenders.file]
+type = "file"
+path = "./logs/app.log"
+format = "json"
+rotate = {interval = "Daily", count = 7, maxAge = "168h", compress = "gzip"}
+
+[appenders.loki]
+type = "http"
+url = "http://localhost:3100/loki/api/v1/push"
+encoder = "loki"
+labels = {app = "demo"}
+gzip = true
+
+[loggers.root]
+level = "INFO"
+appenders = ["file"]
+
+[loggers."com.app.db"]
+level = "DEBUG"
+additivity = false
+appenders = ["loki"]
+`,
+	}
+	var want *Config
+	for _, name := range []string{"log.json", "log.yaml", "log.toml"} {
+		path := filepath.Join(dir, name)
+		if err = ioutil.WriteFile(path, []byte(files[name]), 0644); err != nil {
+			t.Fatal(err)
+		}
+		config, err := ParseConfig(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = config.Validate(); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+		if want == nil {
+			want = config
+			continue
+		}
+		if !reflect.DeepEqual(config, want) {
+			t.Errorf("%s: got %+v, want %+v as JSON", name, config, want)
+		}
+	}
+	if db := want.Loggers["com.app.db"]; db.Additivity == nil || *db.Additivity || want.Appenders["file"].Rotate.Count != 7 {
+		t.Errorf("got config %+v", want)
+	}
+}
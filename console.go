@@ -0,0 +1,141 @@
+package p_log4go
+
+import (
+	"io"
+	"os"
+	"sync"
+
+	"github.com/thiinbit/p-log4go/file"
+)
+
+// ======== ======== PLogger: Console appender ======== ========
+
+// ColorMode whether the console colorizes levels
+type ColorMode int8
+
+const (
+	ColorAuto   ColorMode = iota // Colorize if the output is a terminal, and neither NO_COLOR set nor TERM=dumb
+	ColorAlways                  // Colorize even if piped
+	ColorNever                   // Plain output
+)
+
+// ConsoleConf console appender conf
+type ConsoleConf struct {
+	Color       ColorMode // ColorAuto by default
+	SplitStderr bool      // Whether records at or above StderrLevel go to stderr, all to stdout if false
+	StderrLevel LogLevel  // Min level to stderr if SplitStderr, e.g. WARN
+}
+
+// levelColors ANSI SGR codes of the levels
+var levelColors = map[LogLevel]string{
+	trace: "90",   // Bright black
+	DEBUG: "36",   // Cyan
+	INFO:  "32",   // Green
+	WARN:  "33",   // Yellow
+	ERROR: "31",   // Red
+	PANIC: "1;31", // Bold red
+	FATAL: "1;35", // Bold magenta
+}
+
+// levelLocator formatter that tells where it put the level name, -1 if it didn't
+type levelLocator interface {
+	formatLevelAt(buf []byte, r *Record) ([]byte, int)
+}
+
+// ColorConsoleAppender appender to stdout, and optionally stderr, colorizing levels on terminals.
+// The level name is colorized where the formatter put it, i.e. [INFO] of TextFormatter or %p of PatternLayout.
+// Lines of other formatters, e.g. JSON, are left plain.
+type ColorConsoleAppender struct {
+	appenderLayout
+	stdout, stderr           io.Writer
+	stdoutColor, stderrColor bool     // Whether to colorize each output
+	splitStderr              bool     // Whether to split records to stderr
+	stderrLevel              LogLevel // Min level to stderr if splitStderr
+
+	mu   sync.Mutex // ensures atomic writes; protects the following fields
+	buf  []byte     // for accumulating text to write
+	line []byte     // for colorizing the formatted line
+}
+
+// NewColorConsoleAppender appender to the console by the conf
+func NewColorConsoleAppender(conf ConsoleConf) *ColorConsoleAppender {
+	return &ColorConsoleAppender{
+		stdout:      os.Stdout,
+		stderr:      os.Stderr,
+		stdoutColor: colorEnabled(conf.Color, os.Stdout),
+		stderrColor: colorEnabled(conf.Color, os.Stderr),
+		splitStderr: conf.SplitStderr,
+		stderrLevel: conf.StderrLevel,
+	}
+}
+
+// colorEnabled whether to colorize the output by the mode
+func colorEnabled(mode ColorMode, f *os.File) bool {
+	switch mode {
+	case ColorAlways:
+		return true
+	case ColorNever:
+		return false
+	}
+	// https://no-color.org
+	if os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	return file.IsTerminal(f)
+}
+
+// Append formats the record and writes it to stdout, or stderr by its level
+func (a *ColorConsoleAppender) Append(r *Record) error {
+	if r.Level < a.Level() {
+		return nil
+	}
+	formatter := a.formatterOf(r)
+	w, color := a.stdout, a.stdoutColor
+	if a.splitStderr && r.Level >= a.stderrLevel {
+		w, color = a.stderr, a.stderrColor
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	locator, located := formatter.(levelLocator)
+	if !color || !located {
+		a.buf = formatter.Format(a.buf[:0], r)
+		_, err := w.Write(a.buf)
+		return err
+	}
+	var levelAt int
+	a.buf, levelAt = locator.formatLevelAt(a.buf[:0], r)
+	a.line = colorizeLevel(a.line[:0], a.buf, levelAt, r.Level)
+	_, err := w.Write(a.line)
+	return err
+}
+
+// colorizeLevel append line to buf, with the level name at i wrapped in the level color
+func colorizeLevel(buf []byte, line []byte, i int, level LogLevel) []byte {
+	name := level.String()
+	code, ok := levelColors[level]
+	if !ok || i < 0 || i+len(name) > len(line) || string(line[i:i+len(name)]) != name {
+		return append(buf, line...)
+	}
+	buf = append(buf, line[:i]...)
+	buf = append(buf, "\x1b["...)
+	buf = append(buf, code...)
+	buf = append(buf, 'm')
+	buf = append(buf, name...)
+	buf = append(buf, "\x1b[0m"...)
+	return append(buf, line[i+len(name):]...)
+}
+
+// Flush nothing buffered, and the console is not a storage
+func (a *ColorConsoleAppender) Flush() error {
+	return nil
+}
+
+// Close the console is left open
+func (a *ColorConsoleAppender) Close() error {
+	return nil
+}
+
+// appenderFlag ConsoleAppender
+func (a *ColorConsoleAppender) appenderFlag() AppenderFlag {
+	return ConsoleAppender
+}
@@ -0,0 +1,71 @@
+package p_log4go
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestColorConsoleAppender(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	appender := &ColorConsoleAppender{stdout: &stdout, stderr: &stderr, stdoutColor: true, splitStderr: true, stderrLevel: WARN}
+	consoleLogger := &PLogger{logLevel: DEBUG, appenders: []Appender{appender}}
+	consoleLogger.Info("to stdout")
+	consoleLogger.Warn("to stderr, piped")
+	consoleLogger.Info("ERROR in the message, INFO")
+	consoleLogger.SetAppenderFormatter(ConsoleAppender, MustPatternLayout("%m %-5p|%n"))
+	consoleLogger.Debug("pattern")
+	consoleLogger.Debug("DEBUG in the message,")
+	consoleLogger.SetAppenderFormatter(ConsoleAppender, &JSONFormatter{})
+	consoleLogger.Error("json")
+
+	wantStdout := "[\x1b[32mINFO\x1b[0m] to stdout\n" + "[\x1b[32mINFO\x1b[0m] ERROR in the message, INFO\n" +
+		"pattern \x1b[36mDEBUG\x1b[0m|\n" + "DEBUG in the message, \x1b[36mDEBUG\x1b[0m|\n"
+	if got := stdout.String(); got != wantStdout {
+		t.Errorf("got stdout %q, want %q", got, wantStdout)
+	}
+	if got := stderr.String(); !strings.HasPrefix(got, "[WARN] to stderr, piped\n{\"level\":\"ERROR\"") {
+		t.Errorf("got stderr %q, want plain", got)
+	}
+}
+
+func TestColorEnabled(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	defer w.Close()
+	if colorEnabled(ColorAuto, w) || !colorEnabled(ColorAlways, w) || colorEnabled(ColorNever, w) {
+		t.Errorf("pipe colorized by auto or never, or not by always")
+	}
+	os.Setenv("NO_COLOR", "1")
+	defer os.Unsetenv("NO_COLOR")
+	if colorEnabled(ColorAuto, os.Stdout) {
+		t.Errorf("colorized with NO_COLOR")
+	}
+}
+
+func TestColorizeLevelTruncated(t *testing.T) {
+	var stdout bytes.Buffer
+	appender := &ColorConsoleAppender{stdout: &stdout, stdoutColor: true}
+	appender.SetFormatter(MustPatternLayout("%.1p %m%n"))
+	appender.Append(&Record{Level: WARN, Message: "WARN"})
+	if got, want := stdout.String(), "N WARN\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestConsoleStderrLevelTrace(t *testing.T) {
+	conf, err := (&AppenderConfig{StderrLevel: "trace"}).consoleConf()
+	if err != nil || !conf.SplitStderr || conf.StderrLevel != trace {
+		t.Fatalf("got conf %+v, err %v, want split from trace", conf, err)
+	}
+	var stdout, stderr bytes.Buffer
+	appender := &ColorConsoleAppender{stdout: &stdout, stderr: &stderr, splitStderr: conf.SplitStderr, stderrLevel: conf.StderrLevel}
+	appender.Append(&Record{Level: trace, Message: "trace"})
+	if stdout.Len() != 0 || !strings.HasPrefix(stderr.String(), "[TRACE] ") {
+		t.Errorf("got stdout %q, stderr %q, want trace to stderr", stdout.String(), stderr.String())
+	}
+}
@@ -0,0 +1,156 @@
+package p_log4go
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/thiinbit/p-log4go/file"
+)
+
+// ======== ======== PLogger: Error handling ======== ========
+
+// ErrorHandler handles failures of logging, e.g. writing or rotating files failed. It's called synchronously
+// by the failed goroutine, possibly with the appender locked, so it must not log to the failed logger.
+type ErrorHandler func(err error)
+
+// FailureStats counters of failures since the process started
+type FailureStats struct {
+	WriteFailures    uint64 // Records failed to append, or files failed to write
+	RotateFailures   uint64 // Files failed to rotate, open, or mill archives
+	InternalFailures uint64 // Others, e.g. InitStd or config reload failed
+}
+
+// failureKind kind of failure counted
+type failureKind int8
+
+const (
+	writeFailure failureKind = iota
+	rotateFailure
+	internalFailure
+)
+
+var (
+	failureCounts [3]uint64    // by failureKind, accessed atomically
+	errorHandler  atomic.Value // ErrorHandler of the package, wrapped in errorHandlerBox
+)
+
+// errorHandlerBox atomic.Value needs a consistent concrete type, and can't store nil
+type errorHandlerBox struct {
+	handler ErrorHandler
+}
+
+// SetErrorHandler set the handler of failures of the package, and of the loggers without their own.
+// Nil restores the default, which writes rate limited diagnostics to the original stderr.
+func SetErrorHandler(handler ErrorHandler) {
+	errorHandler.Store(errorHandlerBox{handler})
+}
+
+// SetErrorHandler set the handler of failures of logging by the logger, e.g. returned by appenders.
+// Nil uses the package handler, see SetErrorHandler.
+func (l *PLogger) SetErrorHandler(handler ErrorHandler) {
+	l.errorHandler.Store(errorHandlerBox{handler})
+}
+
+// Failures counters of failures since the process started
+func Failures() FailureStats {
+	return FailureStats{
+		WriteFailures:    atomic.LoadUint64(&failureCounts[writeFailure]),
+		RotateFailures:   atomic.LoadUint64(&failureCounts[rotateFailure]),
+		InternalFailures: atomic.LoadUint64(&failureCounts[internalFailure]),
+	}
+}
+
+// reportError count the failure, and handle it by the package handler
+func reportError(kind failureKind, err error) {
+	atomic.AddUint64(&failureCounts[kind], 1)
+	if box, _ := errorHandler.Load().(errorHandlerBox); box.handler != nil {
+		box.handler(err)
+		return
+	}
+	diagnostics.report(err)
+}
+
+// reportedError an error already counted and handled where it happened, e.g. by RotateConf.OnError,
+// returned to callers but not reported again
+type reportedError struct {
+	err error
+}
+
+func (e reportedError) Error() string {
+	return e.err.Error()
+}
+
+// Unwrap the reported error, for errors.Is and errors.As
+func (e reportedError) Unwrap() error {
+	return e.err
+}
+
+// reportError count the write failure, and handle it by the logger handler or else the package handler
+func (l *PLogger) reportError(err error) {
+	if _, ok := err.(reportedError); ok {
+		return
+	}
+	if box, _ := l.errorHandler.Load().(errorHandlerBox); box.handler != nil {
+		atomic.AddUint64(&failureCounts[writeFailure], 1)
+		box.handler(err)
+		return
+	}
+	reportError(writeFailure, err)
+}
+
+const (
+	diagnosticsPerSecond = 10 // Max diagnostics written per second, the others are counted as suppressed
+)
+
+// diagnostics rate limited writer of failures to the original stderr
+var diagnostics = &diagnosticWriter{}
+
+type diagnosticWriter struct {
+	mu         sync.Mutex // ensures atomic writes; protects the following fields
+	w          io.Writer  // The original stderr, os.Stderr if not duplicated
+	second     int64      // Unix second of the current window
+	written    int        // Written in the current window
+	suppressed int        // Suppressed since the last written
+}
+
+// report write the error unless over the rate
+func (d *diagnosticWriter) report(err error) {
+	now := time.Now()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.w == nil {
+		d.w = os.Stderr
+	}
+	if second := now.Unix(); second != d.second {
+		d.second, d.written = second, 0
+	}
+	if d.written >= diagnosticsPerSecond {
+		d.suppressed++
+		return
+	}
+	d.written++
+	if d.suppressed > 0 {
+		fmt.Fprintf(d.w, "%s p-log4go: %d errors suppressed\n", now.Format(time.RFC3339), d.suppressed)
+		d.suppressed = 0
+	}
+	fmt.Fprintf(d.w, "%s p-log4go: %v\n", now.Format(time.RFC3339), err)
+}
+
+// keepOriginalStderr duplicate the stderr fd for diagnostics, before it's redirected by InitStd
+func (d *diagnosticWriter) keepOriginalStderr() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.w != nil && d.w != os.Stderr {
+		return
+	}
+	fd, err := file.Dup(int(os.Stderr.Fd()))
+	if err != nil {
+		d.w = os.Stderr
+		return
+	}
+	d.w = os.NewFile(uintptr(fd), "stderr")
+}
@@ -0,0 +1,151 @@
+package p_log4go
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestErrorHandler(t *testing.T) {
+	// A closed appender fails to append
+	closedAppender := &memoryAppender{closed: true}
+	handlerLogger := &PLogger{logLevel: DEBUG, appenders: []Appender{closedAppender}}
+	var loggerErrs, packageErrs []error
+	handlerLogger.SetErrorHandler(func(err error) { loggerErrs = append(loggerErrs, err) })
+	SetErrorHandler(func(err error) { packageErrs = append(packageErrs, err) })
+	defer SetErrorHandler(nil)
+
+	before := Failures()
+	handlerLogger.Info("failed")
+	if len(loggerErrs) != 1 || loggerErrs[0] != ErrClosed || len(packageErrs) != 0 {
+		t.Errorf("got logger errors %v, package errors %v, want ErrClosed to the logger handler", loggerErrs, packageErrs)
+	}
+
+	// Without its own handler, to the package handler
+	handlerLogger.SetErrorHandler(nil)
+	handlerLogger.Info("failed")
+	if len(packageErrs) != 1 {
+		t.Errorf("got package errors %v, want 1", packageErrs)
+	}
+
+	// Rotating failed as the dir removed
+	dir, err := ioutil.TempDir("", "plog4go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fileLogger, err := GetLogger3(filepath.Join(dir, "logs", "app.log"), INFO, RotateConf{Interval: Daily, Rotate: 3, MaxBytes: 10}, false, FileAppender)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fileLogger.Close()
+	fileLogger.Info("to file")
+	os.RemoveAll(filepath.Join(dir, "logs"))
+	fileLogger.Info("rotate failed")
+
+	after := Failures()
+	if got := after.WriteFailures - before.WriteFailures; got != 3 {
+		// Two appending and the file failed
+		t.Errorf("got %d write failures, want 3", got)
+	}
+	if got := after.RotateFailures - before.RotateFailures; got != 1 {
+		t.Errorf("got %d rotate failures, want 1", got)
+	}
+	if len(packageErrs) != 3 || !strings.Contains(packageErrs[1].Error(), "open log file error when rotate") {
+		t.Errorf("got package errors %v, want rotate and write errors", packageErrs)
+	}
+}
+
+func TestDiagnosticsRateLimited(t *testing.T) {
+	var buf bytes.Buffer
+	d := &diagnosticWriter{w: &buf}
+	for i := 0; i < diagnosticsPerSecond+5; i++ {
+		d.report(fmt.Errorf("error %d", i))
+	}
+	if got := strings.Count(buf.String(), "\n"); got != diagnosticsPerSecond {
+		t.Errorf("got %d diagnostics, want %d", got, diagnosticsPerSecond)
+	}
+	// The next second
+	d.second--
+	d.report(errors.New("error next"))
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != diagnosticsPerSecond+2 || !strings.HasSuffix(lines[len(lines)-2], "p-log4go: 5 errors suppressed") ||
+		!strings.HasSuffix(lines[len(lines)-1], "p-log4go: error next") {
+		t.Errorf("got %q, want the suppressed count and the next error", buf.String())
+	}
+}
+
+// TestDiagnosticsToOriginalStderr redirects stderr to /dev/null by InitStd in a sub process,
+// the diagnostics should still reach the original stderr
+func TestDiagnosticsToOriginalStderr(t *testing.T) {
+	if os.Getenv("PLOG4GO_INIT_STD") != "" {
+		InitStd(StdOutToConf{To: ToNull})
+		fmt.Fprintln(os.Stderr, "Shouldn't see this")
+		reportError(internalFailure, errors.New("diagnostic after InitStd"))
+		return
+	}
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestDiagnosticsToOriginalStderr$")
+	cmd.Env = append(os.Environ(), "PLOG4GO_INIT_STD=1")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if got := stderr.String(); !strings.Contains(got, "p-log4go: diagnostic after InitStd\n") || strings.Contains(got, "Shouldn't see this") {
+		t.Errorf("got stderr %q", got)
+	}
+}
+
+// TestWriteFailureReportedOnce a failed write is reported by the writer only, to OnError rather than the package handler
+func TestWriteFailureReportedOnce(t *testing.T) {
+	dir, err := ioutil.TempDir("", "plog4go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	var onErrs, packageErrs []error
+	SetErrorHandler(func(err error) { packageErrs = append(packageErrs, err) })
+	defer SetErrorHandler(nil)
+	fileLogger, err := GetLogger3(filepath.Join(dir, "app.log"), INFO,
+		RotateConf{Interval: Daily, OnError: func(err error) { onErrs = append(onErrs, err) }}, false, FileAppender)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fileLogger.Close()
+	// The file fails to write once closed underneath, before checked whether moved
+	w := fileLogger.appenders[0].(*WriterAppender).w.(*timedRotatingWriter)
+	w.lock.Lock()
+	w.fp.Close()
+	w.checkedAt = w.now()
+	w.lock.Unlock()
+
+	before := Failures()
+	if err = fileLogger.Output(1, INFO, "failed"); err == nil {
+		t.Errorf("got nil error from Output, want the write error")
+	}
+	if got := Failures().WriteFailures - before.WriteFailures; got != 1 {
+		t.Errorf("got %d write failures, want 1", got)
+	}
+	if len(onErrs) != 1 || len(packageErrs) != 0 {
+		t.Errorf("got OnError errors %v, package errors %v, want 1 to OnError only", onErrs, packageErrs)
+	}
+}
+
+func TestReportedErrorUnwrap(t *testing.T) {
+	err := error(reportedError{fmt.Errorf("fallback error, %w", ErrClosed)})
+	if !errors.Is(err, ErrClosed) {
+		t.Errorf("errors.Is(%v, ErrClosed) false, want true", err)
+	}
+	var pathErr *os.PathError
+	err = reportedError{&os.PathError{Op: "write", Path: "app.log", Err: os.ErrPermission}}
+	if !errors.As(err, &pathErr) || !errors.Is(err, os.ErrPermission) {
+		t.Errorf("errors.As(%v, *os.PathError) false, want true", err)
+	}
+}
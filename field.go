@@ -0,0 +1,169 @@
+package p_log4go
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ======== ======== PLogger: Structured fields ======== ========
+
+// FieldType type of the field value
+type FieldType int8
+
+const (
+	StringField FieldType = iota
+	IntField
+	FloatField
+	BoolField
+	DurationField
+	TimeField
+	ErrorField
+	AnyField
+)
+
+// Field a typed key/value carried separately from the log message, e.g.
+//
+//	logger.Infow("user login", String("user", name), Duration("cost", cost), Err(err))
+type Field struct {
+	Key   string      // Field key
+	Type  FieldType   // Value type
+	Int   int64       // Value of IntField, DurationField, BoolField(1 is true)
+	Float float64     // Value of FloatField
+	Str   string      // Value of StringField
+	Any   interface{} // Value of TimeField, ErrorField and AnyField
+}
+
+// String field
+func String(key string, val string) Field {
+	return Field{Key: key, Type: StringField, Str: val}
+}
+
+// Int field
+func Int(key string, val int) Field {
+	return Field{Key: key, Type: IntField, Int: int64(val)}
+}
+
+// Int64 field
+func Int64(key string, val int64) Field {
+	return Field{Key: key, Type: IntField, Int: val}
+}
+
+// Float64 field
+func Float64(key string, val float64) Field {
+	return Field{Key: key, Type: FloatField, Float: val}
+}
+
+// Bool field
+func Bool(key string, val bool) Field {
+	var i int64
+	if val {
+		i = 1
+	}
+	return Field{Key: key, Type: BoolField, Int: i}
+}
+
+// Duration field
+func Duration(key string, val time.Duration) Field {
+	return Field{Key: key, Type: DurationField, Int: int64(val)}
+}
+
+// Time field
+func Time(key string, val time.Time) Field {
+	return Field{Key: key, Type: TimeField, Any: val}
+}
+
+// Err field with key "error"
+func Err(err error) Field {
+	return NamedErr("error", err)
+}
+
+// NamedErr error field
+func NamedErr(key string, err error) Field {
+	return Field{Key: key, Type: ErrorField, Any: err}
+}
+
+// Any field of arbitrary objects
+func Any(key string, val interface{}) Field {
+	return Field{Key: key, Type: AnyField, Any: val}
+}
+
+// Value the field value as go type
+func (f Field) Value() interface{} {
+	switch f.Type {
+	case StringField:
+		return f.Str
+	case IntField:
+		return f.Int
+	case FloatField:
+		return f.Float
+	case BoolField:
+		return f.Int == 1
+	case DurationField:
+		return time.Duration(f.Int)
+	}
+	return f.Any
+}
+
+// appendFieldsText append fields to buf as ` key=value key2="value 2"`
+func appendFieldsText(buf *[]byte, fields []Field) {
+	for _, f := range fields {
+		*buf = append(*buf, ' ')
+		appendTextValue(buf, f.Key)
+		*buf = append(*buf, '=')
+		appendFieldValueText(buf, f)
+	}
+}
+
+// appendFieldValueText append the field value to buf as text
+func appendFieldValueText(buf *[]byte, f Field) {
+	switch f.Type {
+	case StringField:
+		appendTextValue(buf, f.Str)
+	case IntField:
+		*buf = strconv.AppendInt(*buf, f.Int, 10)
+	case FloatField:
+		*buf = strconv.AppendFloat(*buf, f.Float, 'g', -1, 64)
+	case BoolField:
+		*buf = strconv.AppendBool(*buf, f.Int == 1)
+	case DurationField:
+		*buf = append(*buf, time.Duration(f.Int).String()...)
+	case TimeField:
+		*buf = f.Any.(time.Time).AppendFormat(*buf, time.RFC3339Nano)
+	default:
+		appendTextValue(buf, fmt.Sprint(f.Any))
+	}
+}
+
+// appendTextValue append s, quoted if it's empty or has spaces, quotes, '=' or non printable chars
+func appendTextValue(buf *[]byte, s string) {
+	if needsQuote(s) {
+		*buf = strconv.AppendQuote(*buf, s)
+		return
+	}
+	*buf = append(*buf, s...)
+}
+
+func needsQuote(s string) bool {
+	if len(s) == 0 {
+		return true
+	}
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c < utf8.RuneSelf {
+			if c <= ' ' || c == '=' || c == '"' || c == 0x7f {
+				return true
+			}
+			i++
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError || !unicode.IsPrint(r) {
+			return true
+		}
+		i += size
+	}
+	return false
+}
@@ -0,0 +1,77 @@
+package p_log4go
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFieldsText(t *testing.T) {
+	at := time.Date(2021, 6, 13, 11, 54, 18, 489905000, time.UTC)
+	tests := []struct {
+		field Field
+		want  string
+	}{
+		{String("user", "thiin"), " user=thiin"},
+		{String("msg", "hello world"), ` msg="hello world"`},
+		{String("empty", ""), ` empty=""`},
+		{String("quote", `a"b=c`), ` quote="a\"b=c"`},
+		{String("multi", "line1\nline2"), ` multi="line1\nline2"`},
+		{String("utf8", "日志"), " utf8=日志"},
+		{Int("count", -3), " count=-3"},
+		{Int64("bytes", 1<<40), " bytes=1099511627776"},
+		{Float64("ratio", 0.25), " ratio=0.25"},
+		{Bool("ok", true), " ok=true"},
+		{Duration("cost", 1500*time.Millisecond), " cost=1.5s"},
+		{Time("at", at), " at=2021-06-13T11:54:18.489905Z"},
+		{Err(errors.New("disk full")), ` error="disk full"`},
+		{Err(nil), " error=<nil>"},
+		{Any("ids", []int{1, 2}), ` ids="[1 2]"`},
+		{String("my key", "v"), ` "my key"=v`},
+	}
+	for _, tt := range tests {
+		var buf []byte
+		appendFieldsText(&buf, []Field{tt.field})
+		if string(buf) != tt.want {
+			t.Errorf("got %s, want %s", buf, tt.want)
+		}
+	}
+}
+
+func TestFieldValue(t *testing.T) {
+	if v := Bool("ok", true).Value(); v != true {
+		t.Errorf("got %v, want true", v)
+	}
+	if v := Duration("cost", time.Second).Value(); v != time.Second {
+		t.Errorf("got %v, want 1s", v)
+	}
+	if v := Int("count", 3).Value(); v != int64(3) {
+		t.Errorf("got %v, want 3", v)
+	}
+}
+
+func TestStructuredLog(t *testing.T) {
+	var buf bytes.Buffer
+	structuredLogger := &PLogger{logLevel: INFO, out: &buf, flag: Lshortfile}
+
+	structuredLogger.Debugw("Shouldn't see this.", String("k", "v"))
+	structuredLogger.Infow("user login", String("user", "thiin"), Duration("cost", 20*time.Millisecond))
+	structuredLogger.Warnw("ends with newline\n", Int("retry", 2))
+	structuredLogger.Info("printf %s still works", "style")
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("got %d lines, want 3: %q", len(lines), buf.String())
+	}
+	if !strings.HasPrefix(lines[0], "[INFO] field_test.go:") || !strings.HasSuffix(lines[0], ": user login user=thiin cost=20ms") {
+		t.Errorf("unexpected line %q", lines[0])
+	}
+	if !strings.HasSuffix(lines[1], ": ends with newline retry=2") {
+		t.Errorf("unexpected line %q", lines[1])
+	}
+	if !strings.HasSuffix(lines[2], ": printf style still works") {
+		t.Errorf("unexpected line %q", lines[2])
+	}
+}
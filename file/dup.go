@@ -10,3 +10,13 @@ import "golang.org/x/sys/unix"
 func SyscallDup(oldfd int, newfd int) (err error) {
 	return unix.Dup2(oldfd, newfd)
 }
+
+// Dup duplicate the fd to the lowest unused fd, closed on exec
+func Dup(oldfd int) (int, error) {
+	fd, err := unix.Dup(oldfd)
+	if err != nil {
+		return -1, err
+	}
+	unix.CloseOnExec(fd)
+	return fd, nil
+}
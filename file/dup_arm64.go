@@ -12,3 +12,13 @@ func SyscallDup(oldfd int, newfd int) (err error) {
 	// so use the nearly identical syscall.Dup3 instead.
 	return syscall.Dup3(oldfd, newfd, 0)
 }
+
+// Dup duplicate the fd to the lowest unused fd, closed on exec
+func Dup(oldfd int) (int, error) {
+	fd, err := syscall.Dup(oldfd)
+	if err != nil {
+		return -1, err
+	}
+	syscall.CloseOnExec(fd)
+	return fd, nil
+}
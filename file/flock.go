@@ -17,3 +17,9 @@ func Flock(file *os.File) error {
 func Funlock(file *os.File) error {
 	return syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
 }
+
+// FlockWait
+func FlockWait(file *os.File) error {
+	// Blocks until the file lock is released by its holder.
+	return syscall.Flock(int(file.Fd()), syscall.LOCK_EX)
+}
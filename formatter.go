@@ -0,0 +1,123 @@
+package p_log4go
+
+import (
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// ======== ======== PLogger: Formatter ======== ========
+
+// Formatter formats a record to a log line. Implement it to register your own layout by PLogger.SetFormatter.
+type Formatter interface {
+	// Format appends the record to buf as one log line, including the trailing newline, and returns the extended buf
+	Format(buf []byte, r *Record) []byte
+}
+
+// TextFormatter the default layout, controlled by the flag bits, e.g.
+//
+//	[INFO] 2021/06/13 11:54:18.489905 main.go:12: msg key=value
+type TextFormatter struct {
+	Flag int // Ldate | Ltime | Lmicroseconds | Lshortfile ...
+}
+
+// Format the record as the text layout
+func (f *TextFormatter) Format(buf []byte, r *Record) []byte {
+	buf, _ = f.formatLevelAt(buf, r)
+	return buf
+}
+
+// formatLevelAt format the record, and return where the level name is, after the [
+func (f *TextFormatter) formatLevelAt(buf []byte, r *Record) ([]byte, int) {
+	levelAt := len(buf) + 1
+	f.formatHeader(&buf, r.Level, r.Prefix, r.Time, r.File, r.Line)
+	msg := r.Message
+	if len(r.Fields) > 0 {
+		// Fields follow the message on the same line
+		msg = strings.TrimSuffix(msg, "\n")
+	}
+	buf = append(buf, msg...)
+	appendFieldsText(&buf, r.Fields)
+	if len(msg) == 0 || msg[len(msg)-1] != '\n' {
+		buf = append(buf, '\n')
+	}
+	return buf, levelAt
+}
+
+// recordNeeds caller needed if the flag has Lshortfile or Llongfile, so appenders can log callers on their own
+func (f *TextFormatter) recordNeeds() recordNeed {
+	return flagNeeds(f.Flag)
+}
+
+// flagNeeds record info needed by the flag bits
+func flagNeeds(flag int) recordNeed {
+	if flag&(Lshortfile|Llongfile) != 0 {
+		return needCaller
+	}
+	return 0
+}
+
+// formatterHolder holds formatters of different types in atomic.Value
+type formatterHolder struct {
+	formatter Formatter
+}
+
+// SetFormatter set formatter of log lines, it's safe to change while logging
+func (l *PLogger) SetFormatter(formatter Formatter) {
+	l.formatter.Store(formatterHolder{formatter: formatter})
+}
+
+// Formatter of log lines, the parent's for named loggers or a TextFormatter with the logger flag if not set
+func (l *PLogger) Formatter() Formatter {
+	if holder, ok := l.formatter.Load().(formatterHolder); ok && holder.formatter != nil {
+		return holder.formatter
+	}
+	if l.parent != nil {
+		return l.parent.Formatter()
+	}
+	formatter := &TextFormatter{Flag: l.flag}
+	l.SetFormatter(formatter)
+	return formatter
+}
+
+// recordNeed record info costly to capture, captured only if the formatter needs it
+type recordNeed int8
+
+const (
+	needCaller    recordNeed = 1 << iota // Record.File and Record.Line
+	needFunction                         // Record.Function
+	needGoroutine                        // Record.Goroutine
+)
+
+// recordNeedsOf record info needed by the formatter or appender
+func recordNeedsOf(v interface{}) recordNeed {
+	if n, ok := v.(interface{ recordNeeds() recordNeed }); ok {
+		return n.recordNeeds()
+	}
+	return 0
+}
+
+// funcName function name of pc without the import path, e.g. p-log4go.(*PLogger).Info
+func funcName(pc uintptr) string {
+	fn := runtime.FuncForPC(pc)
+	if fn == nil {
+		return "???"
+	}
+	name := fn.Name()
+	if i := strings.LastIndexByte(name, '/'); i >= 0 {
+		name = name[i+1:]
+	}
+	return name
+}
+
+// goroutineID id of the current goroutine, parsed from the stack header "goroutine 18 [running]:"
+func goroutineID() int64 {
+	var b [64]byte
+	stack := string(b[:runtime.Stack(b[:], false)])
+	stack = strings.TrimPrefix(stack, "goroutine ")
+	if i := strings.IndexByte(stack, ' '); i > 0 {
+		id, _ := strconv.ParseInt(stack[:i], 10, 64)
+		return id
+	}
+	return 0
+}
@@ -0,0 +1,62 @@
+package p_log4go
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+// levelMsgFormatter a custom layout: LEVEL|msg
+type levelMsgFormatter struct{}
+
+func (levelMsgFormatter) Format(buf []byte, r *Record) []byte {
+	buf = append(buf, r.Level.String()...)
+	buf = append(buf, '|')
+	buf = append(buf, r.Message...)
+	return append(buf, '\n')
+}
+
+func TestSetFormatter(t *testing.T) {
+	var buf bytes.Buffer
+	formatterLogger := &PLogger{logLevel: DEBUG, out: &buf, flag: Lshortfile}
+	formatterLogger.Info("default layout")
+	formatterLogger.SetFormatter(levelMsgFormatter{})
+	formatterLogger.Warn("custom layout")
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines, want 2", len(lines))
+	}
+	if !strings.HasPrefix(lines[0], "[INFO] formatter_test.go:") {
+		t.Errorf("unexpected default layout %q", lines[0])
+	}
+	if lines[1] != "WARN|custom layout" {
+		t.Errorf("unexpected custom layout %q", lines[1])
+	}
+}
+
+func TestTextFormatter(t *testing.T) {
+	r := &Record{
+		Time:    time.Date(2021, 6, 13, 11, 54, 18, 489905000, time.UTC),
+		Level:   WARN,
+		File:    "/a/b/c/d.go",
+		Line:    23,
+		Prefix:  "db: ",
+		Message: "message",
+		Fields:  []Field{Int("retry", 2)},
+	}
+	tests := []struct {
+		flag int
+		want string
+	}{
+		{LstdFlags | LUTC, "[WARN] db: 2021/06/13 11:54:18 message retry=2\n"},
+		{Ldate | Lmicroseconds | Llongfile | LUTC, "[WARN] db: 2021/06/13 11:54:18.489905 /a/b/c/d.go:23: message retry=2\n"},
+		{Lshortfile | Lmsgprefix, "[WARN] d.go:23: db: message retry=2\n"},
+	}
+	for _, tt := range tests {
+		if got := string((&TextFormatter{Flag: tt.flag}).Format(nil, r)); got != tt.want {
+			t.Errorf("got %q, want %q", got, tt.want)
+		}
+	}
+}
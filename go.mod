@@ -2,4 +2,8 @@ module github.com/thiinbit/p-log4go
 
 go 1.14
 
-require golang.org/x/sys v0.0.0-20210611083646-a4fc73990273
+require (
+	github.com/BurntSushi/toml v0.3.1
+	golang.org/x/sys v0.0.0-20210611083646-a4fc73990273
+	gopkg.in/yaml.v2 v2.4.0
+)
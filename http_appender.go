@@ -0,0 +1,415 @@
+package p_log4go
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ======== ======== PLogger: HTTP batch appender ======== ========
+
+// BatchRecord a record formatted by the appender formatter, batched to post
+type BatchRecord struct {
+	Time  time.Time // Logging time
+	Level LogLevel  // Log level
+	Line  []byte    // Formatted record, without the trailing newline
+}
+
+// BatchEncoder encodes batches to request bodies. Implement it to post to your own ingestion endpoint.
+type BatchEncoder interface {
+	// ContentType of the body, e.g. application/json
+	ContentType() string
+	// Encode appends the body of the batch to buf and returns the extended buf
+	Encode(buf []byte, batch []BatchRecord) []byte
+}
+
+// JSONArrayEncoder body of a JSON array of the lines: [{...},{...}]. The lines must be JSON, e.g. by JSONFormatter.
+type JSONArrayEncoder struct{}
+
+// ContentType application/json
+func (JSONArrayEncoder) ContentType() string {
+	return "application/json"
+}
+
+// Encode the lines as a JSON array
+func (JSONArrayEncoder) Encode(buf []byte, batch []BatchRecord) []byte {
+	buf = append(buf, '[')
+	for i, r := range batch {
+		if i > 0 {
+			buf = append(buf, ',')
+		}
+		buf = append(buf, r.Line...)
+	}
+	return append(buf, ']')
+}
+
+// ElasticsearchEncoder body of the Elasticsearch _bulk API, indexing each line as a document.
+// The lines must be JSON, e.g. by JSONFormatter.
+type ElasticsearchEncoder struct {
+	Index string // Index of the documents, empty means the index in the URL, e.g. http://es:9200/logs/_bulk
+}
+
+// ContentType application/x-ndjson
+func (ElasticsearchEncoder) ContentType() string {
+	return "application/x-ndjson"
+}
+
+// Encode an index action line and a document line per record
+func (e ElasticsearchEncoder) Encode(buf []byte, batch []BatchRecord) []byte {
+	for _, r := range batch {
+		if e.Index == "" {
+			buf = append(buf, `{"index":{}}`...)
+		} else {
+			buf = append(buf, `{"index":{"_index":`...)
+			appendJSONString(&buf, e.Index)
+			buf = append(buf, "}}"...)
+		}
+		buf = append(buf, '\n')
+		buf = append(buf, r.Line...)
+		buf = append(buf, '\n')
+	}
+	return buf
+}
+
+// LokiEncoder body of the Loki push API, a stream per level labeled with the labels and level="INFO"
+type LokiEncoder struct {
+	Labels map[string]string // Stream labels, e.g. {"job": "app"}
+}
+
+// ContentType application/json
+func (LokiEncoder) ContentType() string {
+	return "application/json"
+}
+
+// Encode {"streams":[{"stream":{"job":"app","level":"INFO"},"values":[["<unix nano>","line"]]}]}
+func (e LokiEncoder) Encode(buf []byte, batch []BatchRecord) []byte {
+	keys := make([]string, 0, len(e.Labels))
+	for k := range e.Labels {
+		if k != "level" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	var levels []LogLevel
+	streams := make(map[LogLevel][]BatchRecord)
+	for _, r := range batch {
+		if _, ok := streams[r.Level]; !ok {
+			levels = append(levels, r.Level)
+		}
+		streams[r.Level] = append(streams[r.Level], r)
+	}
+
+	buf = append(buf, `{"streams":[`...)
+	for i, level := range levels {
+		if i > 0 {
+			buf = append(buf, ',')
+		}
+		buf = append(buf, `{"stream":{`...)
+		for _, k := range keys {
+			appendJSONString(&buf, k)
+			buf = append(buf, ':')
+			appendJSONString(&buf, e.Labels[k])
+			buf = append(buf, ',')
+		}
+		buf = append(buf, `"level":`...)
+		appendJSONString(&buf, level.String())
+		buf = append(buf, `},"values":[`...)
+		for j, r := range streams[level] {
+			if j > 0 {
+				buf = append(buf, ',')
+			}
+			buf = append(buf, `["`...)
+			buf = strconv.AppendInt(buf, r.Time.UnixNano(), 10)
+			buf = append(buf, `",`...)
+			appendJSONString(&buf, string(r.Line))
+			buf = append(buf, ']')
+		}
+		buf = append(buf, "]}"...)
+	}
+	return append(buf, "]}"...)
+}
+
+// HTTPConf http appender conf
+type HTTPConf struct {
+	URL     string       // Ingestion endpoint, e.g. http://loki:3100/loki/api/v1/push
+	Encoder BatchEncoder // JSONArrayEncoder by default
+	Header  http.Header  // Extra request headers, e.g. Authorization
+	Gzip    bool         // Gzip the request bodies
+	Client  *http.Client // http.DefaultClient by default
+
+	// A batch is posted when any of the limits is reached
+	BatchCount int           // Max records per batch, 100 by default
+	BatchBytes int           // Max bytes of lines per batch, 1MB by default
+	BatchWait  time.Duration // Max time a record waits in the batch, 1s by default
+	MaxBatches int           // Max full batches waiting to be posted, newer batches are dropped beyond. 8 by default
+
+	// Failed posts are retried on network errors, 5xx and 429. Retry-After of 429 is honored.
+	// A batch still failing is dropped and reported to the error handler as a write failure.
+	MaxRetries int           // 3 by default, -1 means no retry
+	MinBackoff time.Duration // Retry backoff, doubled on each retry. 100ms by default
+	MaxBackoff time.Duration // Max retry backoff, 10s by default
+}
+
+// HTTPStats counters of the http appender
+type HTTPStats struct {
+	Sent    uint64 // Records posted
+	Dropped uint64 // Records dropped, by a full queue or failed posts
+	Retries uint64 // Retried posts
+}
+
+// HTTPAppender appender posting batches of records to an HTTP ingestion endpoint from a background goroutine.
+// Records are formatted by JSONFormatter if no formatter set.
+type HTTPAppender struct {
+	appenderLayout
+	conf HTTPConf
+
+	mu         sync.Mutex         // protects the following fields
+	batch      []BatchRecord      // Current batch
+	batchBytes int                // Bytes of lines in the current batch
+	batchStart time.Time          // When the first record of the current batch appended
+	stats      HTTPStats          // Counters
+	closed     bool               // whether closed
+	batches    chan []BatchRecord // Full batches waiting to be posted
+	flushCh    chan chan struct{} // Flush requests, replied after posted
+	done       chan struct{}      // Closed when the background goroutine exits
+}
+
+// NewHTTPAppender appender posting to the url by the conf
+func NewHTTPAppender(conf HTTPConf) (*HTTPAppender, error) {
+	if conf.URL == "" {
+		return nil, errors.New("http appender url not set")
+	}
+	if conf.Encoder == nil {
+		conf.Encoder = JSONArrayEncoder{}
+	}
+	if conf.Client == nil {
+		conf.Client = http.DefaultClient
+	}
+	if conf.BatchCount <= 0 {
+		conf.BatchCount = 100
+	}
+	if conf.BatchBytes <= 0 {
+		conf.BatchBytes = 1 << 20
+	}
+	if conf.BatchWait <= 0 {
+		conf.BatchWait = time.Second
+	}
+	if conf.MaxBatches <= 0 {
+		conf.MaxBatches = 8
+	}
+	if conf.MaxRetries == 0 {
+		conf.MaxRetries = 3
+	}
+	if conf.MinBackoff <= 0 {
+		conf.MinBackoff = 100 * time.Millisecond
+	}
+	if conf.MaxBackoff < conf.MinBackoff {
+		conf.MaxBackoff = 10 * time.Second
+		if conf.MaxBackoff < conf.MinBackoff {
+			conf.MaxBackoff = conf.MinBackoff
+		}
+	}
+	a := &HTTPAppender{
+		conf:    conf,
+		batches: make(chan []BatchRecord, conf.MaxBatches),
+		flushCh: make(chan chan struct{}),
+		done:    make(chan struct{}),
+	}
+	a.SetFormatter(&JSONFormatter{})
+	go a.run()
+	return a, nil
+}
+
+// Append formats the record to the current batch, which is queued to post if full
+func (a *HTTPAppender) Append(r *Record) error {
+	if r.Level < a.Level() {
+		return nil
+	}
+	line := a.formatterOf(r).Format(nil, r)
+	line = bytes.TrimSuffix(line, []byte{'\n'})
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.closed {
+		return ErrClosed
+	}
+	if len(a.batch) == 0 {
+		a.batchStart = time.Now()
+	}
+	a.batch = append(a.batch, BatchRecord{Time: r.Time, Level: r.Level, Line: line})
+	a.batchBytes += len(line)
+	if len(a.batch) < a.conf.BatchCount && a.batchBytes < a.conf.BatchBytes {
+		return nil
+	}
+	batch := a.takeBatchLocked()
+	select {
+	case a.batches <- batch:
+		return nil
+	default:
+		a.stats.Dropped += uint64(len(batch))
+		return fmt.Errorf("http appender queue full, %d records dropped", len(batch))
+	}
+}
+
+// takeBatchLocked take the current batch and start a new one. a.mu must be held.
+func (a *HTTPAppender) takeBatchLocked() []BatchRecord {
+	batch := a.batch
+	a.batch, a.batchBytes = nil, 0
+	return batch
+}
+
+// run post the queued batches, and the current batch once it waits for BatchWait
+func (a *HTTPAppender) run() {
+	defer close(a.done)
+	ticker := time.NewTicker(a.conf.BatchWait / 4)
+	defer ticker.Stop()
+	var body []byte
+	for {
+		select {
+		case batch := <-a.batches:
+			body = a.post(body, batch)
+		case <-ticker.C:
+			a.mu.Lock()
+			var batch []BatchRecord
+			if len(a.batch) > 0 && time.Since(a.batchStart) >= a.conf.BatchWait {
+				batch = a.takeBatchLocked()
+			}
+			a.mu.Unlock()
+			if batch != nil {
+				body = a.post(body, batch)
+			}
+		case reply := <-a.flushCh:
+			// Queued batches first, then the current one
+			for drained := false; !drained; {
+				select {
+				case batch := <-a.batches:
+					body = a.post(body, batch)
+				default:
+					drained = true
+				}
+			}
+			a.mu.Lock()
+			batch, closed := a.takeBatchLocked(), a.closed
+			a.mu.Unlock()
+			if len(batch) > 0 {
+				body = a.post(body, batch)
+			}
+			close(reply)
+			if closed {
+				return
+			}
+		}
+	}
+}
+
+// post the batch with retries, body is the buffer to encode reused across posts
+func (a *HTTPAppender) post(body []byte, batch []BatchRecord) []byte {
+	body = a.conf.Encoder.Encode(body[:0], batch)
+	if a.conf.Gzip {
+		var zbuf bytes.Buffer
+		zw := gzip.NewWriter(&zbuf)
+		zw.Write(body)
+		zw.Close()
+		body = append(body[:0], zbuf.Bytes()...)
+	}
+	backoff := a.conf.MinBackoff
+	for attempt := 0; ; attempt++ {
+		retryAfter, err := a.postOnce(body)
+		if err == nil {
+			a.mu.Lock()
+			a.stats.Sent += uint64(len(batch))
+			a.mu.Unlock()
+			return body
+		}
+		if retryAfter < 0 || attempt >= a.conf.MaxRetries {
+			a.mu.Lock()
+			a.stats.Dropped += uint64(len(batch))
+			a.mu.Unlock()
+			reportError(writeFailure, fmt.Errorf("http appender post error after %d attempts, %d records dropped, %v", attempt+1, len(batch), err))
+			return body
+		}
+		if retryAfter < backoff {
+			retryAfter = backoff
+		}
+		time.Sleep(retryAfter)
+		if backoff *= 2; backoff > a.conf.MaxBackoff {
+			backoff = a.conf.MaxBackoff
+		}
+		a.mu.Lock()
+		a.stats.Retries++
+		a.mu.Unlock()
+	}
+}
+
+// postOnce post the body. Returns the retry after duration if retryable, or negative if not.
+func (a *HTTPAppender) postOnce(body []byte) (time.Duration, error) {
+	req, err := http.NewRequest(http.MethodPost, a.conf.URL, bytes.NewReader(body))
+	if err != nil {
+		return -1, err
+	}
+	for k, vs := range a.conf.Header {
+		for _, v := range vs {
+			req.Header.Add(k, v)
+		}
+	}
+	req.Header.Set("Content-Type", a.conf.Encoder.ContentType())
+	if a.conf.Gzip {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	resp, err := a.conf.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	// Drain to reuse the connection
+	io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+	switch {
+	case resp.StatusCode < 300:
+		return 0, nil
+	case resp.StatusCode == http.StatusTooManyRequests:
+		seconds, _ := strconv.Atoi(resp.Header.Get("Retry-After"))
+		return time.Duration(seconds) * time.Second, fmt.Errorf("post logs status %s", resp.Status)
+	case resp.StatusCode >= 500:
+		return 0, fmt.Errorf("post logs status %s", resp.Status)
+	}
+	return -1, fmt.Errorf("post logs status %s", resp.Status)
+}
+
+// Flush posts the queued batches and the current batch, and waits until posted
+func (a *HTTPAppender) Flush() error {
+	reply := make(chan struct{})
+	select {
+	case a.flushCh <- reply:
+		<-reply
+	case <-a.done:
+	}
+	return nil
+}
+
+// Close posts the pending records and stops the background goroutine
+func (a *HTTPAppender) Close() error {
+	a.mu.Lock()
+	if a.closed {
+		a.mu.Unlock()
+		return nil
+	}
+	a.closed = true
+	a.mu.Unlock()
+	a.Flush()
+	<-a.done
+	return nil
+}
+
+// Stats counters of the appender
+func (a *HTTPAppender) Stats() HTTPStats {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.stats
+}
@@ -0,0 +1,202 @@
+package p_log4go
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// ingestServer an ingestion endpoint keeping the bodies, replying the statuses in order then 200
+type ingestServer struct {
+	mu       sync.Mutex
+	statuses []int
+	bodies   []string
+	requests int
+}
+
+func (s *ingestServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body := r.Body
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		zr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		body = zr
+	}
+	data, _ := ioutil.ReadAll(body)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests++
+	if len(s.statuses) > 0 {
+		status := s.statuses[0]
+		s.statuses = s.statuses[1:]
+		if status == http.StatusTooManyRequests {
+			w.Header().Set("Retry-After", "0")
+		}
+		w.WriteHeader(status)
+		return
+	}
+	s.bodies = append(s.bodies, string(data))
+}
+
+func (s *ingestServer) received() ([]string, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.bodies...), s.requests
+}
+
+func TestHTTPAppenderBatch(t *testing.T) {
+	ingest := &ingestServer{}
+	server := httptest.NewServer(ingest)
+	defer server.Close()
+
+	appender, err := NewHTTPAppender(HTTPConf{URL: server.URL, Gzip: true, BatchCount: 3, BatchWait: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	httpLogger := &PLogger{logLevel: DEBUG}
+	httpLogger.AttachAppender(appender)
+	for i := 0; i < 7; i++ {
+		httpLogger.Infow("batched", Int("i", i))
+	}
+	// Full batches are posted without waiting
+	waitFor(t, 5*time.Second, func() bool {
+		bodies, _ := ingest.received()
+		return len(bodies) == 2
+	})
+	httpLogger.Close()
+
+	bodies, _ := ingest.received()
+	if len(bodies) != 3 {
+		t.Fatalf("got %d bodies, want 3", len(bodies))
+	}
+	i := 0
+	for _, body := range bodies {
+		var batch []map[string]interface{}
+		if err := json.Unmarshal([]byte(body), &batch); err != nil {
+			t.Fatalf("invalid JSON array %s, %v", body, err)
+		}
+		for _, obj := range batch {
+			if obj["msg"] != "batched" || obj["i"] != float64(i) {
+				t.Errorf("got %v, want record %d", obj, i)
+			}
+			i++
+		}
+	}
+	if stats := appender.Stats(); stats.Sent != 7 || stats.Dropped != 0 {
+		t.Errorf("got stats %+v", stats)
+	}
+	if err := appender.Append(&Record{Level: INFO}); err != ErrClosed {
+		t.Errorf("got %v, want ErrClosed", err)
+	}
+}
+
+func TestHTTPAppenderBatchWait(t *testing.T) {
+	ingest := &ingestServer{}
+	server := httptest.NewServer(ingest)
+	defer server.Close()
+
+	appender, err := NewHTTPAppender(HTTPConf{URL: server.URL, BatchWait: 20 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer appender.Close()
+	appender.Append(&Record{Level: INFO, Message: "waited"})
+	waitFor(t, 5*time.Second, func() bool {
+		bodies, _ := ingest.received()
+		return len(bodies) == 1 && strings.Contains(bodies[0], `"msg":"waited"`)
+	})
+}
+
+func TestHTTPAppenderRetry(t *testing.T) {
+	tests := []struct {
+		statuses     []int
+		wantRequests int
+		wantSent     uint64
+	}{
+		{[]int{503, 429}, 3, 1},
+		{[]int{500, 500, 500, 500}, 4, 0},
+		{[]int{400}, 1, 0},
+	}
+	for _, tt := range tests {
+		ingest := &ingestServer{statuses: tt.statuses}
+		server := httptest.NewServer(ingest)
+		appender, err := NewHTTPAppender(HTTPConf{URL: server.URL, MinBackoff: time.Millisecond, MaxBackoff: time.Millisecond})
+		if err != nil {
+			t.Fatal(err)
+		}
+		appender.Append(&Record{Level: ERROR, Message: "retried"})
+		appender.Close()
+		server.Close()
+
+		_, requests := ingest.received()
+		stats := appender.Stats()
+		if requests != tt.wantRequests || stats.Sent != tt.wantSent || stats.Sent+stats.Dropped != 1 {
+			t.Errorf("statuses %v got %d requests, stats %+v", tt.statuses, requests, stats)
+		}
+	}
+}
+
+func TestHTTPAppenderReportsDropped(t *testing.T) {
+	var mu sync.Mutex
+	var errs []error
+	SetErrorHandler(func(err error) {
+		mu.Lock()
+		errs = append(errs, err)
+		mu.Unlock()
+	})
+	defer SetErrorHandler(nil)
+
+	ingest := &ingestServer{statuses: []int{502, 502}}
+	server := httptest.NewServer(ingest)
+	defer server.Close()
+	appender, err := NewHTTPAppender(HTTPConf{URL: server.URL, MaxRetries: 1, MinBackoff: time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := Failures()
+	appender.Append(&Record{Level: ERROR, Message: "dropped"})
+	appender.Append(&Record{Level: ERROR, Message: "dropped"})
+	appender.Close()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "2 records dropped, post logs status 502") {
+		t.Errorf("got errors %v, want the dropped batch reported", errs)
+	}
+	if got := Failures().WriteFailures - before.WriteFailures; got != 1 {
+		t.Errorf("got %d write failures, want 1", got)
+	}
+}
+
+func TestBatchEncoders(t *testing.T) {
+	batch := []BatchRecord{
+		{Time: time.Unix(1, 5), Level: INFO, Line: []byte(`{"msg":"a"}`)},
+		{Time: time.Unix(2, 0), Level: ERROR, Line: []byte(`{"msg":"b"}`)},
+		{Time: time.Unix(3, 0), Level: INFO, Line: []byte(`{"msg":"c"}`)},
+	}
+	tests := []struct {
+		encoder BatchEncoder
+		want    string
+	}{
+		{JSONArrayEncoder{}, `[{"msg":"a"},{"msg":"b"},{"msg":"c"}]`},
+		{ElasticsearchEncoder{Index: "logs"}, "{\"index\":{\"_index\":\"logs\"}}\n{\"msg\":\"a\"}\n" +
+			"{\"index\":{\"_index\":\"logs\"}}\n{\"msg\":\"b\"}\n{\"index\":{\"_index\":\"logs\"}}\n{\"msg\":\"c\"}\n"},
+		{ElasticsearchEncoder{}, "{\"index\":{}}\n{\"msg\":\"a\"}\n{\"index\":{}}\n{\"msg\":\"b\"}\n{\"index\":{}}\n{\"msg\":\"c\"}\n"},
+		{LokiEncoder{Labels: map[string]string{"job": "app", "env": "prod"}}, `{"streams":[` +
+			`{"stream":{"env":"prod","job":"app","level":"INFO"},"values":[["1000000005","{\"msg\":\"a\"}"],["3000000000","{\"msg\":\"c\"}"]]},` +
+			`{"stream":{"env":"prod","job":"app","level":"ERROR"},"values":[["2000000000","{\"msg\":\"b\"}"]]}]}`},
+	}
+	for _, tt := range tests {
+		if got := string(tt.encoder.Encode(nil, batch)); got != tt.want {
+			t.Errorf("%T got %s, want %s", tt.encoder, got, tt.want)
+		}
+	}
+}
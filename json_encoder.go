@@ -0,0 +1,184 @@
+package p_log4go
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// ======== ======== PLogger: JSON encoder ======== ========
+
+// Encoding of log lines
+type Encoding int32
+
+const (
+	// [INFO] 2021/06/13 11:54:18.489905 main.go:12: msg key=value
+	TextEncoding Encoding = iota
+	// {"level":"INFO","time":"2021-06-13T11:54:18.489905+08:00","caller":"main.go:12","msg":"msg","key":"value"}
+	JSONEncoding
+)
+
+// SetEncoding set the built in formatter of log lines by encoding, TextEncoding by default
+func (l *PLogger) SetEncoding(encoding Encoding) {
+	if encoding == JSONEncoding {
+		l.SetFormatter(&JSONFormatter{Flag: l.flag})
+		return
+	}
+	l.SetFormatter(&TextFormatter{Flag: l.flag})
+}
+
+// JSONFormatter formats one JSON object per line, with level, RFC3339Nano time, caller, logger name or prefix, message and fields.
+// Flag LUTC and Lshortfile are respected.
+type JSONFormatter struct {
+	Flag int // LUTC | Lshortfile ...
+}
+
+// recordNeeds caller needed if the flag has Lshortfile or Llongfile
+func (f *JSONFormatter) recordNeeds() recordNeed {
+	return flagNeeds(f.Flag)
+}
+
+// Format the record as a JSON line
+func (f *JSONFormatter) Format(buf []byte, r *Record) []byte {
+	buf = append(buf, `{"level":`...)
+	appendJSONString(&buf, r.Level.String())
+
+	t := r.Time
+	if f.Flag&LUTC != 0 {
+		t = t.UTC()
+	}
+	buf = append(buf, `,"time":"`...)
+	buf = t.AppendFormat(buf, time.RFC3339Nano)
+	buf = append(buf, '"')
+
+	if r.File != "" {
+		file := r.File
+		if f.Flag&Lshortfile != 0 {
+			if i := strings.LastIndexByte(file, '/'); i >= 0 {
+				file = file[i+1:]
+			}
+		}
+		buf = append(buf, `,"caller":"`...)
+		appendJSONStringContent(&buf, file)
+		buf = append(buf, ':')
+		buf = strconv.AppendInt(buf, int64(r.Line), 10)
+		buf = append(buf, '"')
+	}
+
+	if logger := r.Logger; logger != "" || r.Prefix != "" {
+		if logger == "" {
+			logger = r.Prefix
+		}
+		buf = append(buf, `,"logger":`...)
+		appendJSONString(&buf, logger)
+	}
+
+	buf = append(buf, `,"msg":`...)
+	appendJSONString(&buf, strings.TrimSuffix(r.Message, "\n"))
+
+	for _, field := range r.Fields {
+		buf = append(buf, ',')
+		appendJSONString(&buf, field.Key)
+		buf = append(buf, ':')
+		appendJSONValue(&buf, field)
+	}
+	return append(buf, "}\n"...)
+}
+
+// appendJSONValue append the field value as JSON
+func appendJSONValue(buf *[]byte, f Field) {
+	switch f.Type {
+	case StringField:
+		appendJSONString(buf, f.Str)
+	case IntField:
+		*buf = strconv.AppendInt(*buf, f.Int, 10)
+	case FloatField:
+		if math.IsNaN(f.Float) || math.IsInf(f.Float, 0) {
+			// Not representable as JSON number
+			appendJSONString(buf, strconv.FormatFloat(f.Float, 'g', -1, 64))
+			return
+		}
+		*buf = strconv.AppendFloat(*buf, f.Float, 'g', -1, 64)
+	case BoolField:
+		*buf = strconv.AppendBool(*buf, f.Int == 1)
+	case DurationField:
+		appendJSONString(buf, time.Duration(f.Int).String())
+	case TimeField:
+		*buf = append(*buf, '"')
+		*buf = f.Any.(time.Time).AppendFormat(*buf, time.RFC3339Nano)
+		*buf = append(*buf, '"')
+	case ErrorField:
+		if f.Any == nil {
+			*buf = append(*buf, "null"...)
+			return
+		}
+		appendJSONString(buf, f.Any.(error).Error())
+	default:
+		b, err := json.Marshal(f.Any)
+		if err != nil {
+			appendJSONString(buf, fmt.Sprintf("%+v", f.Any))
+			return
+		}
+		*buf = append(*buf, b...)
+	}
+}
+
+// appendJSONString append s as a quoted JSON string
+func appendJSONString(buf *[]byte, s string) {
+	*buf = append(*buf, '"')
+	appendJSONStringContent(buf, s)
+	*buf = append(*buf, '"')
+}
+
+const hexDigits = "0123456789abcdef"
+
+// appendJSONStringContent append s escaped as JSON string content, like encoding/json.
+// Control chars, U+2028, U+2029 are escaped and invalid UTF-8 is replaced by U+FFFD.
+func appendJSONStringContent(buf *[]byte, s string) {
+	start := 0
+	for i := 0; i < len(s); {
+		if c := s[i]; c < utf8.RuneSelf {
+			if c >= 0x20 && c != '"' && c != '\\' {
+				i++
+				continue
+			}
+			*buf = append(*buf, s[start:i]...)
+			switch c {
+			case '"', '\\':
+				*buf = append(*buf, '\\', c)
+			case '\n':
+				*buf = append(*buf, '\\', 'n')
+			case '\r':
+				*buf = append(*buf, '\\', 'r')
+			case '\t':
+				*buf = append(*buf, '\\', 't')
+			default:
+				*buf = append(*buf, '\\', 'u', '0', '0', hexDigits[c>>4], hexDigits[c&0xf])
+			}
+			i++
+			start = i
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			*buf = append(*buf, s[start:i]...)
+			*buf = append(*buf, `\ufffd`...)
+			i += size
+			start = i
+			continue
+		}
+		if r == '\u2028' || r == '\u2029' {
+			*buf = append(*buf, s[start:i]...)
+			*buf = append(*buf, '\\', 'u', '2', '0', '2', hexDigits[r&0xf])
+			i += size
+			start = i
+			continue
+		}
+		i += size
+	}
+	*buf = append(*buf, s[start:]...)
+}
@@ -0,0 +1,101 @@
+package p_log4go
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestJSONEncoding(t *testing.T) {
+	var buf bytes.Buffer
+	jsonLogger := &PLogger{logLevel: DEBUG, out: &buf, prefix: "db", flag: Lshortfile | LUTC}
+	jsonLogger.SetEncoding(JSONEncoding)
+
+	jsonLogger.Infow("multi\nline \"quoted\" \x01 \u2028 tab\t",
+		String("user", "thiin"),
+		Int("count", 3),
+		Float64("ratio", 0.5),
+		Float64("nan", math.NaN()),
+		Bool("ok", true),
+		Duration("cost", 20*time.Millisecond),
+		Err(errors.New("disk full")),
+		NamedErr("cause", nil),
+		Any("ids", []int{1, 2}),
+	)
+	jsonLogger.Warn("printf %s\n", "style")
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines, want one JSON object per line: %q", len(lines), buf.String())
+	}
+
+	var obj map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[0]), &obj); err != nil {
+		t.Fatalf("invalid JSON %s, %v", lines[0], err)
+	}
+	want := map[string]interface{}{
+		"level":  "INFO",
+		"logger": "db",
+		"msg":    "multi\nline \"quoted\" \x01 \u2028 tab\t",
+		"user":   "thiin",
+		"count":  3.0,
+		"ratio":  0.5,
+		"nan":    "NaN",
+		"ok":     true,
+		"cost":   "20ms",
+		"error":  "disk full",
+		"cause":  nil,
+	}
+	for k, v := range want {
+		if obj[k] != v {
+			t.Errorf("got %s=%#v, want %#v", k, obj[k], v)
+		}
+	}
+	if ids, ok := obj["ids"].([]interface{}); !ok || len(ids) != 2 {
+		t.Errorf("got ids=%#v, want [1 2]", obj["ids"])
+	}
+	if caller, _ := obj["caller"].(string); !strings.HasPrefix(caller, "json_encoder_test.go:") {
+		t.Errorf("got caller %q", caller)
+	}
+	ts, err := time.Parse(time.RFC3339Nano, obj["time"].(string))
+	if err != nil || ts.Location() != time.UTC {
+		t.Errorf("got time %v, %v", obj["time"], err)
+	}
+
+	if err := json.Unmarshal([]byte(lines[1]), &obj); err != nil {
+		t.Fatalf("invalid JSON %s, %v", lines[1], err)
+	}
+	if obj["level"] != "WARN" || obj["msg"] != "printf style" {
+		t.Errorf("unexpected line %s", lines[1])
+	}
+}
+
+func TestJSONStringEscaping(t *testing.T) {
+	tests := []string{
+		"plain",
+		"",
+		`back\slash "quote"`,
+		"\x00\x1f\x7f\r\n\t",
+		"日志 \u2028\u2029",
+		"<html>&",
+	}
+	for _, s := range tests {
+		var buf []byte
+		appendJSONString(&buf, s)
+		var got string
+		if err := json.Unmarshal(buf, &got); err != nil || got != s {
+			t.Errorf("got %q (%v), want %q", got, err, s)
+		}
+	}
+
+	// Invalid UTF-8 replaced
+	var buf []byte
+	appendJSONString(&buf, "bad\xffbyte")
+	if string(buf) != `"bad\ufffdbyte"` {
+		t.Errorf("got %s", buf)
+	}
+}
@@ -0,0 +1,76 @@
+package p_log4go
+
+import (
+	"io/ioutil"
+	"sync"
+	"testing"
+)
+
+func TestIsEnabled(t *testing.T) {
+	levelLogger := &PLogger{logLevel: WARN}
+	if levelLogger.IsEnabled(INFO) || !levelLogger.IsEnabled(WARN) || !levelLogger.IsEnabled(FATAL) {
+		t.Errorf("got enabled levels not by WARN")
+	}
+	if levelLogger.IsEnabled(trace) {
+		t.Errorf("got trace enabled before StartTrace")
+	}
+	levelLogger.StartTrace()
+	levelLogger.SetLevel(DEBUG)
+	if !levelLogger.IsEnabled(trace) || !levelLogger.IsEnabled(DEBUG) || levelLogger.GetLevel() != DEBUG {
+		t.Errorf("got trace or DEBUG not enabled after changes")
+	}
+
+	oldLevel := GetLevel()
+	defer SetLevel(oldLevel)
+	SetLevel(ERROR)
+	if IsEnabled(WARN) || !IsEnabled(ERROR) || defaultLogger.GetLevel() != ERROR {
+		t.Errorf("got default logger level %v, want ERROR", defaultLogger.GetLevel())
+	}
+}
+
+// TestLevelChangeWhileLogging run with -race
+func TestLevelChangeWhileLogging(t *testing.T) {
+	root := &PLogger{logLevel: INFO, out: ioutil.Discard}
+	reg := newLoggerRegistry(root)
+	loggers := []*PLogger{root, reg.get("com.app"), reg.get("com.app.db")}
+
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	for _, l := range loggers {
+		wg.Add(1)
+		go func(l *PLogger) {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				l.Trace("trace")
+				l.Debug("debug")
+				l.Infow("info", Int("n", 1))
+				l.Warn("warn")
+				if l.IsEnabled(DEBUG) {
+					l.Error("error")
+				}
+			}
+		}(l)
+	}
+
+	levels := []LogLevel{trace, DEBUG, INFO, WARN, ERROR}
+	for i := 0; i < 1000; i++ {
+		l := loggers[i%len(loggers)]
+		l.SetLevel(levels[i%len(levels)])
+		if i%2 == 0 {
+			l.StartTrace()
+		} else {
+			l.StopTrace()
+		}
+		if i%7 == 0 {
+			l.ResetLevel()
+		}
+		_ = l.GetLevel()
+	}
+	close(stop)
+	wg.Wait()
+}
@@ -0,0 +1,112 @@
+package p_log4go
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCloseFlushesAsync(t *testing.T) {
+	dir, err := ioutil.TempDir("", "plog4go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	logPath := filepath.Join(dir, "close.log")
+	closeLogger, err := GetLogger3(logPath, INFO, RotateConf{Interval: Daily, Rotate: 3, Compressor: GzipCompressor}, false, FileAppender)
+	if err != nil {
+		t.Fatal(err)
+	}
+	closeLogger.EnableAsync(AsyncConf{QueueSize: 16})
+	for i := 0; i < 100; i++ {
+		closeLogger.Info("INFO. Line %02d should be flushed when closed.", i)
+	}
+	if err = closeLogger.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if stats := closeLogger.AsyncStats(); stats.Written != 100 {
+		t.Errorf("got %d written after sync, want 100", stats.Written)
+	}
+	closeLogger.Info("INFO. Last line should be flushed when closed.")
+	if err = closeLogger.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err = closeLogger.Output(1, INFO, "Shouldn't see this."); err != ErrClosed {
+		t.Errorf("got %v after closed, want ErrClosed", err)
+	}
+	if err = closeLogger.Close(); err != nil {
+		t.Errorf("close twice, %v", err)
+	}
+
+	content, _ := ioutil.ReadFile(logPath)
+	if lines := strings.Count(string(content), "\n"); lines != 101 {
+		t.Errorf("got %d lines, want 101", lines)
+	}
+}
+
+func TestWriterClose(t *testing.T) {
+	dir, err := ioutil.TempDir("", "plog4go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	w, err := newTimedRotateWriter(filepath.Join(dir, "writer.log"), RotateConf{Interval: Hourly, Rotate: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = w.Write([]byte("line\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err = w.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = w.Write([]byte("line\n")); err != ErrClosed {
+		t.Errorf("got %v after closed, want ErrClosed", err)
+	}
+	if err = w.Sync(); err != nil {
+		t.Errorf("sync after closed, %v", err)
+	}
+}
+
+// TestFatalFlushes runs Fatal of an async logger in a sub process, the fatal log should reach the file
+func TestFatalFlushes(t *testing.T) {
+	if logPath := os.Getenv("PLOG4GO_FATAL_LOG"); logPath != "" {
+		fatalLogger, _ := GetLogger(logPath, INFO, Daily, 3)
+		fatalLogger.EnableAsync(AsyncConf{})
+		for i := 0; i < 1000; i++ {
+			fatalLogger.Info("INFO. Line %03d before fatal.", i)
+		}
+		fatalLogger.Fatal("FATAL. Should see this in %s", logPath)
+		return
+	}
+
+	dir, err := ioutil.TempDir("", "plog4go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	logPath := filepath.Join(dir, "fatal.log")
+	cmd := exec.Command(os.Args[0], "-test.run=^TestFatalFlushes$")
+	cmd.Env = append(os.Environ(), "PLOG4GO_FATAL_LOG="+logPath)
+	err = cmd.Run()
+	if exitErr, ok := err.(*exec.ExitError); !ok || exitErr.ExitCode() != 1 {
+		t.Fatalf("got %v, want exit status 1", err)
+	}
+
+	content, _ := ioutil.ReadFile(logPath)
+	if lines := strings.Count(string(content), "\n"); lines != 1001 {
+		t.Errorf("got %d lines, want 1001", lines)
+	}
+	if !strings.Contains(string(content), "[FATAL]") {
+		t.Error("fatal log not found")
+	}
+}
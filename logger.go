@@ -1,23 +1,25 @@
 package p_log4go
 
 import (
+	"errors"
 	"fmt"
 	"github.com/thiinbit/p-log4go/file"
 	"io"
 	"os"
+	"os/signal"
 	"path"
 	"path/filepath"
 	"runtime"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 )
 
-const (
-	// One day
-	nanoSecInOneDay = int64(time.Hour * 24)
-	// One week
-	nanoSecInOneWeek = nanoSecInOneDay * 7
-)
+// ErrClosed returned when logging to a closed logger or writer
+var ErrClosed = errors.New("logger is closed")
 
 // ======== ======== PLogger: TimeRotated writer ======== ========
 
@@ -31,52 +33,153 @@ const (
 	Weekly RotateInterval = "Weekly"
 )
 
-// eastUTCOffset east UTC offset in nanoSecs, use to name rotate file
-var eastUTCOffset = func() int64 {
-	// Calc  its offset in seconds east of UTC.
-	_, secOffset := time.Now().In(time.Local).Zone()
-	return int64(secOffset) * int64(time.Second)
-}()
+// File rotating conf
+type RotateConf struct {
+	Interval RotateInterval // Time based rotating interval: Hourly/Daily/Weekly
+	Rotate   int64          // Past periods kept, e.g. 7 days of Daily besides today. All numbered archives of a period count as one
+	MaxBytes int64          // Max bytes per file. Also rotate by size when > 0, archives are numbered: app.log.2021-06-13.1
+	// Archives of periods beyond Rotate count are deleted, and optionally
+	MaxAge        time.Duration // Archives older than max age, 0 means no limit
+	MaxTotalBytes int64         // Archives over the total bytes budget, 0 means no limit
+	Compressor    Compressor    // Compress archives in background if set, e.g. GzipCompressor
+	FileMode      os.FileMode   // Permission of the log files before umask, 0644 if 0
+	// Set when several processes log to the same file, e.g. prefork servers. Rotating is then serialized
+	// by an advisory lock on <file>.lock, and a process reopens the file rotated by another.
+	MultiProcess bool
+	// While the file can't be opened or written, e.g. disk full or the dir read only, output goes to
+	// Fallback, e.g. os.Stderr, or else to the file of the same name in FallbackDir. Dropped if neither set.
+	Fallback    io.Writer
+	FallbackDir string
+	// OnError is called on file errors, e.g. failed rotating, instead of printing them.
+	// It's called with the file locked, so it must not log to the same file.
+	OnError func(err error)
+	// Location of the calendar rotating by: periods start at the local hour, midnight or Monday midnight,
+	// and archives are named by the local date, following DST changes. time.Local if nil
+	Location *time.Location
+
+	clock func() time.Time // Current time, time.Now if nil. Injected by tests
+}
 
 // timedRotatingWriter
 type timedRotatingWriter struct {
-	lock            sync.Mutex     // Write file lock
-	filename        string         // File name
-	fp              *os.File       // File pointer
-	interval        RotateInterval // File rotating interval
-	intervalNanoSec int64          // File rotating interval nanoSec
-	format          string         // Rotated file name format
-	rotate          int64          // Rotate file count
-	rotateDateIndex int64          // Rotate flag
-	eastOfUTCOffset int64          // east of UTC offset(nanoSecs)
+	lock          sync.Mutex       // Write file lock
+	filename      string           // File name
+	fp            *os.File         // File pointer
+	interval      RotateInterval   // File rotating interval
+	format        string           // Rotated file name format
+	rotate        int64            // Rotate file count
+	location      *time.Location   // Location of the calendar rotating by
+	period        time.Time        // Start of the rotate period of the current file
+	periodEnd     time.Time        // Start of the next rotate period, when to rotate
+	now           func() time.Time // Current time, time.Now unless injected by tests
+	maxBytes      int64            // Max bytes per file, 0 means no size limit
+	size          int64            // Current file size
+	maxAge        time.Duration    // Max age of archives, 0 means no limit
+	maxTotalBytes int64            // Max total bytes of archives, 0 means no limit
+	compressor    Compressor       // Archives compressor, nil means no compression
+	mode          os.FileMode      // Permission of the log files
+	multiProcess  bool             // Whether to coordinate rotating with other processes
+	checkedAt     time.Time        // Last time checked whether the file moved, see reopenIfMoved
+	retryAt       time.Time        // When to retry rotating or opening the file after failed
+	fallback      io.Writer        // Where output goes while the file can't be written
+	fallbackDir   string           // Dir of the fallback file, opened on the first fallback if no fallback writer
+	fallbackFile  *os.File         // Fallback file opened in the fallback dir
+	onError       func(error)      // Called on file errors
+	millCh        chan struct{}    // Notify the mill goroutine to compress and cleanup archives
+	millDone      chan struct{}    // Closed when the mill goroutine exits
+	closed        bool             // Whether closed
 }
 
 // NewRotateWrite new writer
-func newTimedRotateWriter(filename string, interval RotateInterval, rotate int64) (*timedRotatingWriter, error) {
+func newTimedRotateWriter(filename string, conf RotateConf) (*timedRotatingWriter, error) {
 	w := &timedRotatingWriter{
-		filename: filename,
-		interval: interval,
-		rotate:   rotate,
+		filename:      filename,
+		rotate:        conf.Rotate,
+		maxBytes:      conf.MaxBytes,
+		maxAge:        conf.MaxAge,
+		maxTotalBytes: conf.MaxTotalBytes,
+		compressor:    conf.Compressor,
+		mode:          conf.FileMode,
+		multiProcess:  conf.MultiProcess,
+		fallback:      conf.Fallback,
+		fallbackDir:   conf.FallbackDir,
+		onError:       conf.OnError,
+		location:      conf.Location,
+		now:           conf.clock,
+	}
+	if w.mode == 0 {
+		w.mode = defaultFileMode
+	}
+	if w.location == nil {
+		w.location = time.Local
 	}
+	if w.now == nil {
+		w.now = time.Now
+	}
+	if w.compressor != nil {
+		w.millCh = make(chan struct{}, 1)
+		w.millDone = make(chan struct{})
+	}
+
+	w.setInterval(conf.Interval)
 
+	err := w.initialize()
+	if err != nil {
+		return nil, fmt.Errorf("error when init logger, %s", err)
+	}
+	if w.compressor != nil {
+		go w.millRun()
+	}
+
+	return w, nil
+}
+
+// setInterval set rotating interval and the archive name format of the interval
+func (w *timedRotatingWriter) setInterval(interval RotateInterval) {
+	w.interval = interval
 	switch interval {
 	case Hourly:
-		w.intervalNanoSec = int64(time.Hour)
 		w.format = "2006-01-02_15"
 	case Daily:
-		w.intervalNanoSec = nanoSecInOneDay
 		w.format = "2006-01-02"
 	case Weekly:
-		w.intervalNanoSec = nanoSecInOneWeek
 		w.format = "2006-01-02"
 	}
+}
 
-	err := w.initialize()
-	if err != nil {
-		return nil, fmt.Errorf("error when init logger, %s", err)
+// periodOf start of the rotate period containing t, by the calendar of the location
+func (w *timedRotatingWriter) periodOf(t time.Time) time.Time {
+	t = t.In(w.location)
+	switch w.interval {
+	case Hourly:
+		// Back to the hour by duration, as the local hour repeats when DST ends
+		return t.Add(-time.Duration(t.Minute())*time.Minute - time.Duration(t.Second())*time.Second - time.Duration(t.Nanosecond()))
+	case Weekly:
+		// Weeks start on Monday
+		year, month, day := t.Date()
+		return time.Date(year, month, day-(int(t.Weekday())+6)%7, 0, 0, 0, 0, w.location)
 	}
+	year, month, day := t.Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, w.location)
+}
 
-	return w, nil
+// setPeriod set the rotate period of the current file by its start
+func (w *timedRotatingWriter) setPeriod(start time.Time) {
+	w.period = start
+	switch w.interval {
+	case Hourly:
+		w.periodEnd = start.Add(time.Hour)
+	case Weekly:
+		w.periodEnd = time.Date(start.Year(), start.Month(), start.Day()+7, 0, 0, 0, 0, w.location)
+	default:
+		// 23 or 25 hours when DST changes
+		w.periodEnd = time.Date(start.Year(), start.Month(), start.Day()+1, 0, 0, 0, 0, w.location)
+	}
+}
+
+// inPeriod whether t is in the rotate period of the current file
+func (w *timedRotatingWriter) inPeriod(t time.Time) bool {
+	return !t.Before(w.period) && t.Before(w.periodEnd)
 }
 
 // initialize
@@ -87,65 +190,304 @@ func (w *timedRotatingWriter) initialize() error {
 	var err error
 	fileInfo, err := os.Stat(w.filename)
 	if err == nil {
-		w.rotateDateIndex = (fileInfo.ModTime().UnixNano() + eastUTCOffset) / w.intervalNanoSec
+		w.setPeriod(w.periodOf(fileInfo.ModTime()))
+		w.size = fileInfo.Size()
 	} else {
-		w.rotateDateIndex = (time.Now().UnixNano() + eastUTCOffset) / w.intervalNanoSec
+		w.setPeriod(w.periodOf(w.now()))
 	}
-	w.fp, err = os.OpenFile(w.filename, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	w.fp, err = os.OpenFile(w.filename, os.O_CREATE|os.O_WRONLY|os.O_APPEND, w.mode)
 	if err != nil {
 		return err
 	}
+	// Archives may be left over beyond retention or uncompressed when the process was down
+	if w.compressor != nil {
+		w.mill()
+	} else {
+		unlock := w.lockRotate()
+		if err = w.cleanup(); err != nil {
+			reportError(rotateFailure, fmt.Errorf("cleanup archives error when init, %v", err))
+		}
+		unlock()
+	}
 	return nil
 }
 
-// try rotate
-// There may be concurrency problems when renaming files
-func (w *timedRotatingWriter) tryRotate() (err error) {
+// lockRotate lock rotating and archives across processes sharing the file, until unlock called.
+// Each call opens the lock file anew, so the lock is exclusive between goroutines too.
+// Nothing is locked unless multi process.
+func (w *timedRotatingWriter) lockRotate() (unlock func()) {
+	if !w.multiProcess {
+		return func() {}
+	}
+	lockFile, err := os.OpenFile(w.filename+".lock", os.O_CREATE|os.O_RDWR, w.mode)
+	if err != nil {
+		reportError(rotateFailure, fmt.Errorf("open lock file error, %v", err))
+		return func() {}
+	}
+	if err = file.FlockWait(lockFile); err != nil {
+		reportError(rotateFailure, fmt.Errorf("lock file error, file: %s: err: %v", lockFile.Name(), err))
+		lockFile.Close()
+		return func() {}
+	}
+	return func() {
+		file.Funlock(lockFile)
+		lockFile.Close()
+	}
+}
+
+// reopenIfMoved reopen the file if moved or deleted, e.g. by logrotate or rotated by another process,
+// returns whether reopened. Size of the file is refreshed too, as it may be truncated or written by other processes.
+func (w *timedRotatingWriter) reopenIfMoved() bool {
+	fileInfo, err := os.Stat(w.filename)
+	if err == nil && w.fp != nil {
+		if fpInfo, fpErr := w.fp.Stat(); fpErr == nil && os.SameFile(fileInfo, fpInfo) {
+			w.size = fpInfo.Size()
+			return false
+		}
+	}
+	if err = w.reopen(); err != nil {
+		w.reportError(rotateFailure, fmt.Errorf("reopen log file error, %v", err))
+	}
+	return true
+}
+
+// Reopen close and reopen the file by its path, e.g. on SIGHUP after the file moved by logrotate
+func (w *timedRotatingWriter) Reopen() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.closed {
+		return ErrClosed
+	}
+	w.checkedAt = w.now()
+	return w.reopen()
+}
+
+// reopen the file by its path, w.lock must be held
+func (w *timedRotatingWriter) reopen() (err error) {
+	if w.fp != nil {
+		w.fp.Close()
+		w.fp = nil
+	}
+	if w.fp, err = os.OpenFile(w.filename, os.O_CREATE|os.O_WRONLY|os.O_APPEND, w.mode); err != nil {
+		return err
+	}
+	w.size = 0
+	w.setPeriod(w.periodOf(w.now()))
+	if fpInfo, err := w.fp.Stat(); err == nil && fpInfo.Size() > 0 {
+		// Written before, e.g. by another process
+		w.size = fpInfo.Size()
+		w.setPeriod(w.periodOf(fpInfo.ModTime()))
+	}
+	return nil
+}
+
+// exceedMaxBytes whether writing n bytes exceeds max bytes of current file
+func (w *timedRotatingWriter) exceedMaxBytes(n int) bool {
+	return w.maxBytes > 0 && w.size > 0 && w.size+int64(n) > w.maxBytes
+}
+
+// nextArchiveName numbered archive name of the period, after the largest existing number
+func (w *timedRotatingWriter) nextArchiveName(period time.Time) string {
+	stamp := period.Format(w.format)
+	maxIndex := 0
+	archives, _ := w.listArchives()
+	for _, archive := range archives {
+		if archive.stamp == stamp && archive.index > maxIndex {
+			maxIndex = archive.index
+		}
+	}
+	return w.filename + "." + stamp + "." + strconv.Itoa(maxIndex+1)
+}
+
+// hasArchive whether any archive of the period exists, compressed or not
+func (w *timedRotatingWriter) hasArchive(period time.Time) bool {
+	stamp := period.Format(w.format)
+	archives, _ := w.listArchives()
+	for _, archive := range archives {
+		if archive.stamp == stamp {
+			return true
+		}
+	}
+	return false
+}
+
+// try rotate, by time interval or by size if max bytes set
+// Renaming files is serialized across processes by the rotate lock if multi process
+func (w *timedRotatingWriter) tryRotate(n int) (err error) {
 	// 0. check should exec rotate
-	now := time.Now()
-	nowDateIndex := (now.UnixNano() + eastUTCOffset) / w.intervalNanoSec
-	if nowDateIndex == w.rotateDateIndex {
+	now := w.now()
+	if now.Sub(w.checkedAt) >= reopenCheckInterval {
+		// The file may be moved, deleted or truncated externally, or rotated by another process
+		w.checkedAt = now
+		w.reopenIfMoved()
+	}
+	if w.inPeriod(now) && !w.exceedMaxBytes(n) {
+		return nil
+	}
+	if now.Before(w.retryAt) {
+		// Failed lately, retried later
 		return nil
 	}
+	if w.multiProcess {
+		unlock := w.lockRotate()
+		defer unlock()
+		// Rotated by another process while waiting for the lock
+		if w.reopenIfMoved() && w.inPeriod(now) && !w.exceedMaxBytes(n) {
+			return nil
+		}
+	}
+	defer func() {
+		if err != nil {
+			w.retryAt = now.Add(rotateRetryInterval)
+			w.reportError(rotateFailure, err)
+		}
+	}()
 	// 1. close existing file if open
 	if w.fp != nil {
-		err = w.fp.Close()
-		if err != nil {
-			fmt.Printf("close exist file error when rotate, file: %s", w.fp.Name())
-			return
+		if closeErr := w.fp.Close(); closeErr != nil {
+			// The file is released even if failed, e.g. delayed write error
+			w.reportError(rotateFailure, fmt.Errorf("close exist file error when rotate, %v", closeErr))
 		}
 		w.fp = nil
 	}
 	// 2. rename dest file if it already exists
-	fInfo, err := os.Stat(w.filename)
-	if err == nil {
-		modeTime := fInfo.ModTime()
-		archiveTime := now.Add(-time.Duration(w.intervalNanoSec) * time.Nanosecond)
-		if modeTime.Before(archiveTime) {
-			archiveTime = modeTime
-			// TODO: Check and delete if has more than rotate amount file
+	var renameErr error
+	if _, statErr := os.Stat(w.filename); statErr == nil {
+		// Named by the period of the file, e.g. app.log.2021-06-13
+		archiveName := w.filename + "." + w.period.Format(w.format)
+		if w.maxBytes > 0 || w.hasArchive(w.period) {
+			// Size rotating enabled, or the local hour repeated when DST ended,
+			// number the archives of the period: app.log.2021-06-13.1, .2
+			archiveName = w.nextArchiveName(w.period)
+		}
+		if renameErr = os.Rename(w.filename, archiveName); renameErr != nil {
+			// Keep writing to the current file, and retry rotating later
+			renameErr = fmt.Errorf("rename log file error when rotate, %v", renameErr)
+		}
+	}
+	// 3. create a new file, or reopen the current one if not renamed
+	period := w.period
+	if err = w.reopen(); err != nil {
+		return fmt.Errorf("open log file error when rotate, %v", err)
+	}
+	if renameErr != nil {
+		w.setPeriod(period)
+		return renameErr
+	}
+	w.retryAt = time.Time{}
+	// 4. update rotate period
+	w.setPeriod(w.periodOf(now))
+	w.size = 0
+	// 5. compress in background or remove archives beyond retention
+	if w.compressor != nil {
+		w.mill()
+	} else if cleanupErr := w.cleanup(); cleanupErr != nil {
+		w.reportError(rotateFailure, fmt.Errorf("cleanup archives error when rotate, %v", cleanupErr))
+	}
+	return nil
+}
+
+// Write writes to the file, rotating it if due. While the file can't be opened or written, e.g. disk full
+// or the dir read only, output goes to the fallback if set, and opening is retried on later writes.
+func (w *timedRotatingWriter) Write(output []byte) (n int, err error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.closed {
+		return 0, ErrClosed
+	}
+	w.tryRotate(len(output))
+	if w.fp == nil && !w.now().Before(w.retryAt) {
+		if err = w.reopen(); err != nil {
+			w.retryAt = w.now().Add(rotateRetryInterval)
+			w.reportError(rotateFailure, fmt.Errorf("reopen log file error, %v", err))
 		}
-		err = os.Rename(w.filename, w.filename+"."+archiveTime.Format(w.format))
+	}
+	if w.fp == nil {
+		n, err = w.writeFallback(output, errors.New("write log file error, file not open"))
 		if err != nil {
-			fmt.Printf("rename log file error when rotate, file: %s: err: %v", w.filename, err)
-			return
+			w.reportError(writeFailure, err)
+			return n, reportedError{err}
 		}
+		return n, nil
 	}
-	// 3. create a new file
-	w.fp, err = os.OpenFile(w.filename, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
-	// 4. update rotate index
-	w.rotateDateIndex = nowDateIndex
-	// 5. remove old file (more older file will delete when check mod time is before archive time)
-	oldestArchiveTime := now.Add(-time.Duration(w.rotate*w.intervalNanoSec) * time.Nanosecond)
-	os.Remove(w.filename + "." + oldestArchiveTime.Format(w.format))
-	return
+	n, err = w.fp.Write(output)
+	w.size += int64(n)
+	if err != nil {
+		w.reportError(writeFailure, fmt.Errorf("write log file error, %v", err))
+		fallbackN, fallbackErr := w.writeFallback(output[n:], err)
+		if fallbackErr != nil {
+			return n + fallbackN, reportedError{fallbackErr}
+		}
+		return n + fallbackN, nil
+	}
+	return n, nil
+}
+
+// writeFallback write output to the fallback, returns err if no fallback set
+func (w *timedRotatingWriter) writeFallback(output []byte, err error) (int, error) {
+	if w.fallback == nil && w.fallbackDir != "" {
+		fallbackPath := filepath.Join(w.fallbackDir, filepath.Base(w.filename))
+		if mkdirErr := os.MkdirAll(w.fallbackDir, 0755); mkdirErr != nil {
+			return 0, fmt.Errorf("%v, and fallback dir error, %v", err, mkdirErr)
+		}
+		fallbackFile, openErr := os.OpenFile(fallbackPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, w.mode)
+		if openErr != nil {
+			return 0, fmt.Errorf("%v, and fallback file error, %v", err, openErr)
+		}
+		w.fallbackFile, w.fallback = fallbackFile, fallbackFile
+	}
+	if w.fallback == nil {
+		return 0, err
+	}
+	return w.fallback.Write(output)
 }
 
-func (w *timedRotatingWriter) Write(output []byte) (int, error) {
+// reportError count the failure, and report it to OnError or else the package error handler. w.lock is held.
+func (w *timedRotatingWriter) reportError(kind failureKind, err error) {
+	if w.onError != nil {
+		atomic.AddUint64(&failureCounts[kind], 1)
+		w.onError(err)
+		return
+	}
+	reportError(kind, fmt.Errorf("log file %s error, %v", w.filename, err))
+}
+
+// Sync commits the current file to disk
+func (w *timedRotatingWriter) Sync() error {
 	w.lock.Lock()
 	defer w.lock.Unlock()
-	w.tryRotate()
-	return w.fp.Write(output)
+	if w.closed || w.fp == nil {
+		return nil
+	}
+	return w.fp.Sync()
+}
+
+// Close syncs and closes the current file, and waits for the background compression to finish
+func (w *timedRotatingWriter) Close() (err error) {
+	w.lock.Lock()
+	if w.closed {
+		w.lock.Unlock()
+		return nil
+	}
+	w.closed = true
+	if w.fp != nil {
+		if err = w.fp.Sync(); err == nil {
+			err = w.fp.Close()
+		} else {
+			w.fp.Close()
+		}
+		w.fp = nil
+	}
+	if w.fallbackFile != nil {
+		w.fallbackFile.Close()
+	}
+	w.lock.Unlock()
+
+	if w.millCh != nil {
+		close(w.millCh)
+		<-w.millDone
+	}
+	return
 }
 
 var (
@@ -177,23 +519,26 @@ var initStdOnce sync.Once
 func InitStd(stdOutTo StdOutToConf) {
 	initStdOnce.Do(func() {
 		var err error
+		// Diagnostics go to the original stderr, even if redirected
+		diagnostics.keepOriginalStderr()
 
 		if nullFile, err = os.OpenFile(os.DevNull, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644); err != nil {
-			fmt.Printf("open /dev/null, err = [%v]", err)
+			reportError(internalFailure, fmt.Errorf("open /dev/null, err = [%v]", err))
+			return
 		}
 
 		// stdin to /dev/null
 		if err = file.SyscallDup(int(nullFile.Fd()), int(os.Stdin.Fd())); err != nil {
-			fmt.Printf("dup2 stdin to /dev/null, err = [%v]", err)
+			reportError(internalFailure, fmt.Errorf("dup2 stdin to /dev/null, err = [%v]", err))
 		}
 
 		// Stdout/stdErr to /dev/null if set ToNull
 		if stdOutTo.To == ToNull {
 			if err = file.SyscallDup(int(nullFile.Fd()), int(os.Stdout.Fd())); err != nil {
-				fmt.Printf("dup2 stdout to null, err = [%v]", err)
+				reportError(internalFailure, fmt.Errorf("dup2 stdout to null, err = [%v]", err))
 			}
 			if err = file.SyscallDup(int(nullFile.Fd()), int(os.Stderr.Fd())); err != nil {
-				fmt.Printf("dup2 stderr to null, err = [%v]", err)
+				reportError(internalFailure, fmt.Errorf("dup2 stderr to null, err = [%v]", err))
 			}
 		}
 
@@ -206,7 +551,8 @@ func InitStd(stdOutTo StdOutToConf) {
 		// Stdout/StdErr to file if set ToFile
 		if stdOutTo.To == ToFile {
 			if len(stdOutTo.ToDir) < 1 {
-				fmt.Printf("stdOutToFile path conf, err = wrongFilePath [%s]", stdOutTo.ToDir)
+				reportError(internalFailure, fmt.Errorf("stdOutToFile path conf, err = wrongFilePath [%s]", stdOutTo.ToDir))
+				return
 			}
 
 			// Rotate old stdout file
@@ -214,16 +560,17 @@ func InitStd(stdOutTo StdOutToConf) {
 			oldStdoutPath := path.Join(stdOutTo.ToDir, "stdout.log."+time.Now().Format("20060102.150405"))
 			os.Rename(latestStdoutPath, oldStdoutPath)
 			if stdoutFile, err = os.OpenFile(latestStdoutPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644); err != nil {
-				fmt.Printf("open stdout.log, err = [%v]", err)
+				reportError(internalFailure, fmt.Errorf("open stdout.log, err = [%v]", err))
+				return
 			}
 
 			// stdout to stdout.log
 			if err = file.SyscallDup(int(stdoutFile.Fd()), int(os.Stdout.Fd())); err != nil {
-				fmt.Printf("dup2 stdout to stdout.log, err = [%v]", err)
+				reportError(internalFailure, fmt.Errorf("dup2 stdout to stdout.log, err = [%v]", err))
 			}
 			// stderr to stdout.log
 			if err = file.SyscallDup(int(stdoutFile.Fd()), int(os.Stderr.Fd())); err != nil {
-				fmt.Printf("dup2 stderr to stdout.log, err = [%v]", err)
+				reportError(internalFailure, fmt.Errorf("dup2 stderr to stdout.log, err = [%v]", err))
 			}
 		}
 
@@ -240,8 +587,11 @@ func InitStd(stdOutTo StdOutToConf) {
 // The prefix is followed by a colon only when Llongfile or Lshortfile
 // is specified.
 // For example, flags Ldate | Ltime (or LstdFlags) produce,
+//
 //	2009/01/23 01:23:23 message
+//
 // while flags Ldate | Ltime | Lmicroseconds | Llongfile produce,
+//
 //	2009/01/23 01:23:23.123123 /a/b/c/d.go:23: message
 const (
 	Ldate         = 1 << iota     // the date in the local time zone: 2009/01/23
@@ -254,8 +604,8 @@ const (
 	LstdFlags     = Ldate | Ltime // initial values for the standard logger
 )
 
-// Appender
-type Appender int8
+// AppenderFlag built in appenders of GetLogger
+type AppenderFlag int8
 
 // Log appender ,
 // - output to file `File`
@@ -266,8 +616,8 @@ const (
 	FileAppender
 )
 
-// Log level DEBUG/INFO/WARN/ERROR
-type LogLevel int8
+// Log level DEBUG/INFO/WARN/ERROR. It's int32 to be loaded and stored atomically.
+type LogLevel int32
 
 // Log level iota
 const (
@@ -280,16 +630,79 @@ const (
 	FATAL
 )
 
+// String level name, e.g. INFO
+func (level LogLevel) String() string {
+	switch level {
+	case trace:
+		return "TRACE"
+	case DEBUG:
+		return "DEBUG"
+	case INFO:
+		return "INFO"
+	case WARN:
+		return "WARN"
+	case ERROR:
+		return "ERROR"
+	case PANIC:
+		return "PANIC"
+	case FATAL:
+		return "FATAL"
+	}
+	return "LEVEL(" + strconv.Itoa(int(level)) + ")"
+}
+
+// ParseLevel parse the level name, case insensitive, e.g. INFO
+func ParseLevel(name string) (LogLevel, error) {
+	for level := trace; level <= FATAL; level++ {
+		if strings.EqualFold(name, level.String()) {
+			return level, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown level %q, must be one of TRACE, DEBUG, INFO, WARN, ERROR, PANIC, FATAL", name)
+}
+
 type PLogger struct {
 	//loggerInst    *log.Logger
-	logLevel      LogLevel // Loglevel DEBUG INFO WARN ERROR
-	isTraceEnable bool     // Is trace enable
+	logLevel      LogLevel // Loglevel DEBUG INFO WARN ERROR, accessed atomically
+	isTraceEnable int32    // Is trace enable, 1 for true, accessed atomically
 	// log.logger
-	mu     sync.Mutex // ensures atomic writes; protects the following fields
-	prefix string     // prefix on each line to identify the logger (but see Lmsgprefix)
-	flag   int        // properties
-	out    io.Writer  // destination for output
-	buf    []byte     // for accumulating text to write
+	mu        sync.Mutex  // ensures atomic writes; protects the following fields
+	prefix    string      // prefix on each line to identify the logger (but see Lmsgprefix)
+	flag      int         // properties
+	out       io.Writer   // destination for output
+	async     *asyncQueue // queue of records written in background if async enabled
+	appenders []Appender  // appenders records are fanned out to, copy on write. out is used if none
+	closed    bool        // whether closed
+	name      string      // logger name, e.g. com.app.db
+	// held for reading while appending, so appenders detached by a config reload are closed after the records in flight
+	appendMu sync.RWMutex
+	// formatter of log lines, *TextFormatter with flag by default
+	formatter atomic.Value
+	// named logger hierarchy, see GetNamedLogger
+	parent      *PLogger   // parent logger, immutable after created
+	children    []*PLogger // child loggers, guarded by hierarchyMu
+	levelSet    bool       // whether the level is set rather than inherited, guarded by hierarchyMu
+	traceSet    bool       // whether trace is started or stopped rather than inherited, guarded by hierarchyMu
+	nonAdditive bool       // don't append to the appenders of the ancestors, guarded by mu
+	// handler of failures of logging, ErrorHandler wrapped in errorHandlerBox
+	errorHandler atomic.Value
+}
+
+// Record a logging event, passed from the log methods to the output
+type Record struct {
+	Time    time.Time // Logging time
+	Level   LogLevel  // Log level
+	File    string    // Caller file, empty if neither Lshortfile nor Llongfile set
+	Line    int       // Caller line
+	Prefix  string    // Logger prefix
+	Message string    // Log message
+	Fields  []Field   // Structured fields
+	// Captured only if the formatter needs them, e.g. PatternLayout with %c %M %t
+	Logger    string // Logger name
+	Function  string // Caller function
+	Goroutine int64  // Caller goroutine id
+
+	formatter Formatter // formatter of the logger, used by appenders without their own
 }
 
 func GetLogger(filePath string, logLevel LogLevel, interval RotateInterval, rotate int64) (*PLogger, error) {
@@ -301,48 +714,20 @@ func GetLogger0(filepath string) (*PLogger, error) {
 	return GetLogger2(filepath, DEBUG, Daily, defaultRotateCount, defaultTraceOn, FileAppender)
 }
 
-func GetLogger1(filePath string, logLevel LogLevel, interval RotateInterval, rotate int64, appender Appender) (*PLogger, error) {
+func GetLogger1(filePath string, logLevel LogLevel, interval RotateInterval, rotate int64, appender AppenderFlag) (*PLogger, error) {
 
 	return GetLogger2(filePath, logLevel, interval, rotate, false, appender)
 }
 
-func GetLogger2(filePath string, logLevel LogLevel, interval RotateInterval, rotate int64, traceOn bool, appender Appender) (*PLogger, error) {
-
-	fileDir := filepath.Dir(filePath)
-	exist, err := pathExists(fileDir)
-	if err != nil {
-		return nil, fmt.Errorf("log file path err, %v", err)
-	}
-
-	if !exist {
-		if err = os.MkdirAll(fileDir, 0755); err != nil {
-			return nil, fmt.Errorf("mkdir logfile dir err, %v", err)
-		}
-	}
-
-	// TODO: Multi writer
-	var writers = make([]io.Writer, 0)
+func GetLogger2(filePath string, logLevel LogLevel, interval RotateInterval, rotate int64, traceOn bool, appender AppenderFlag) (*PLogger, error) {
 
-	if appender&FileAppender != 0 {
-		var fileWriter *timedRotatingWriter
-		fileWriter, err = newTimedRotateWriter(filePath, interval, rotate)
-		if err != nil {
-			return nil, fmt.Errorf("create RotateRiter err, %v", err)
-		}
-		writers = append(writers, fileWriter)
-	}
+	return GetLogger3(filePath, logLevel, RotateConf{Interval: interval, Rotate: rotate}, traceOn, appender)
+}
 
-	if appender&ConsoleAppender != 0 {
-		writers = append(writers, os.Stdout)
-	}
+// GetLogger3 get logger with rotate conf, e.g. rotate by time interval and size. See New for more options.
+func GetLogger3(filePath string, logLevel LogLevel, rotateConf RotateConf, traceOn bool, appender AppenderFlag) (*PLogger, error) {
 
-	return &PLogger{
-		logLevel:      logLevel,
-		isTraceEnable: traceOn,
-		prefix:        "",
-		flag:          Ldate | Ltime | Lmicroseconds | Lshortfile,
-		out:           io.MultiWriter(writers...),
-	}, nil
+	return New(WithFile(filePath), WithLevel(logLevel), WithRotateConf(rotateConf), WithTrace(traceOn), WithAppender(appender))
 }
 
 // Cheap integer to fixed-width decimal ASCII. Give a negative width to avoid zero-padding.
@@ -363,11 +748,11 @@ func itoa(buf *[]byte, i int, wid int) {
 }
 
 // formatHeader writes log header to buf in following order:
-//   * l.prefix (if it's not blank and Lmsgprefix is unset),
-//   * date and/or time (if corresponding flags are provided),
-//   * file and line number (if corresponding flags are provided),
-//   * l.prefix (if it's not blank and Lmsgprefix is set).
-func (l *PLogger) formatHeader(buf *[]byte, level LogLevel, t time.Time, file string, line int) {
+//   - prefix (if it's not blank and Lmsgprefix is unset),
+//   - date and/or time (if corresponding flags are provided),
+//   - file and line number (if corresponding flags are provided),
+//   - prefix (if it's not blank and Lmsgprefix is set).
+func (f *TextFormatter) formatHeader(buf *[]byte, level LogLevel, prefix string, t time.Time, file string, line int) {
 	// Log level
 	switch level {
 	case trace:
@@ -387,16 +772,16 @@ func (l *PLogger) formatHeader(buf *[]byte, level LogLevel, t time.Time, file st
 	}
 
 	// Log msg prefix false
-	if l.flag&Lmsgprefix == 0 {
-		*buf = append(*buf, l.prefix...)
+	if f.Flag&Lmsgprefix == 0 {
+		*buf = append(*buf, prefix...)
 	}
 
 	// Log date time microseconds
-	if l.flag&(Ldate|Ltime|Lmicroseconds) != 0 {
-		if l.flag&LUTC != 0 {
+	if f.Flag&(Ldate|Ltime|Lmicroseconds) != 0 {
+		if f.Flag&LUTC != 0 {
 			t = t.UTC()
 		}
-		if l.flag&Ldate != 0 {
+		if f.Flag&Ldate != 0 {
 			year, month, day := t.Date()
 			itoa(buf, year, 4)
 			*buf = append(*buf, '/')
@@ -405,14 +790,14 @@ func (l *PLogger) formatHeader(buf *[]byte, level LogLevel, t time.Time, file st
 			itoa(buf, day, 2)
 			*buf = append(*buf, ' ')
 		}
-		if l.flag&(Ltime|Lmicroseconds) != 0 {
+		if f.Flag&(Ltime|Lmicroseconds) != 0 {
 			hour, min, sec := t.Clock()
 			itoa(buf, hour, 2)
 			*buf = append(*buf, ':')
 			itoa(buf, min, 2)
 			*buf = append(*buf, ':')
 			itoa(buf, sec, 2)
-			if l.flag&Lmicroseconds != 0 {
+			if f.Flag&Lmicroseconds != 0 {
 				*buf = append(*buf, '.')
 				itoa(buf, t.Nanosecond()/1e3, 6)
 			}
@@ -421,8 +806,8 @@ func (l *PLogger) formatHeader(buf *[]byte, level LogLevel, t time.Time, file st
 	}
 
 	// Log short file | long file
-	if l.flag&(Lshortfile|Llongfile) != 0 {
-		if l.flag&Lshortfile != 0 {
+	if f.Flag&(Lshortfile|Llongfile) != 0 {
+		if f.Flag&Lshortfile != 0 {
 			short := file
 			for i := len(file) - 1; i > 0; i-- {
 				if file[i] == '/' {
@@ -439,8 +824,8 @@ func (l *PLogger) formatHeader(buf *[]byte, level LogLevel, t time.Time, file st
 	}
 
 	// Log msg prefix true
-	if l.flag&Lmsgprefix != 0 {
-		*buf = append(*buf, l.prefix...)
+	if f.Flag&Lmsgprefix != 0 {
+		*buf = append(*buf, prefix...)
 	}
 }
 
@@ -451,45 +836,224 @@ func (l *PLogger) formatHeader(buf *[]byte, level LogLevel, t time.Time, file st
 // provided for generality, although at the moment on all pre-defined
 // paths it will be 2.
 func (l *PLogger) Output(calldepth int, logLevel LogLevel, s string) error {
+	return l.output(calldepth+1, logLevel, s, nil)
+}
+
+// output writes the message with structured fields, calldepth counted from output itself.
+// Errors are reported to the error handler too, as level methods discard them.
+func (l *PLogger) output(calldepth int, logLevel LogLevel, msg string, fields []Field) (err error) {
+	defer func() {
+		if err != nil {
+			l.reportError(err)
+		}
+	}()
 	now := time.Now() // get this early.
-	var file string
-	var line int
 	l.mu.Lock()
-	defer l.mu.Unlock()
-	if l.flag&(Lshortfile|Llongfile) != 0 {
-		// Release lock while getting caller info - it's expensive.
+	if l.closed {
 		l.mu.Unlock()
-		var ok bool
-		_, file, line, ok = runtime.Caller(calldepth)
+		return ErrClosed
+	}
+	q, flag := l.async, l.flag
+	r := Record{Time: now, Level: logLevel, Prefix: l.prefix, Message: msg, Fields: fields, Logger: l.name}
+	// Appenders serialize their own writes, so they're appended to without holding l.mu
+	l.mu.Unlock()
+	// Held until appended, so a config reload doesn't close the appenders meanwhile
+	l.appendMu.RLock()
+	appenders := l.appendersWithAncestors()
+	r.formatter = l.Formatter()
+	needs := recordNeedsOfAppenders(r.formatter, appenders)
+	if flag&(Lshortfile|Llongfile) != 0 || needs&(needCaller|needFunction) != 0 {
+		pc, file, line, ok := runtime.Caller(calldepth)
 		if !ok {
 			file = "???"
 			line = 0
+		} else if needs&needFunction != 0 {
+			r.Function = funcName(pc)
 		}
-		l.mu.Lock()
+		r.File, r.Line = file, line
 	}
-	l.buf = l.buf[:0]
-	l.formatHeader(&l.buf, logLevel, now, file, line)
-	l.buf = append(l.buf, s...)
-	if len(s) == 0 || s[len(s)-1] != '\n' {
-		l.buf = append(l.buf, '\n')
+	if needs&needGoroutine != 0 {
+		r.Goroutine = goroutineID()
 	}
-	_, err := l.out.Write(l.buf)
+	if q != nil {
+		l.appendMu.RUnlock()
+		// Appended by the background goroutine, to the appenders attached then
+		return q.enqueue(r)
+	}
+	err = appendRecord(appenders, &r)
+	l.appendMu.RUnlock()
 	return err
 }
 
-// StartTrace
+// Sync flushes records queued by async writing, and the appenders including those inherited from the ancestors
+func (l *PLogger) Sync() error {
+	l.mu.Lock()
+	q := l.async
+	l.mu.Unlock()
+	if q != nil {
+		q.flush()
+	}
+	appenders := l.appendersWithAncestors()
+	var err error
+	for _, a := range appenders {
+		if flushErr := a.Flush(); flushErr != nil && err == nil {
+			err = flushErr
+		}
+	}
+	return err
+}
+
+// Close flushes and closes the logger and its appenders, and flushes the appenders inherited from the ancestors.
+// Logging after closed returns ErrClosed
+func (l *PLogger) Close() error {
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		return nil
+	}
+	l.closed = true
+	q, appenders := l.async, l.appendersLocked()
+	l.mu.Unlock()
+	if q != nil {
+		q.close()
+	}
+	var err error
+	for _, a := range appenders {
+		if closeErr := a.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}
+	// The ancestors' appenders are shared, only flushed
+	for _, a := range l.ancestorAppenders() {
+		if flushErr := a.Flush(); flushErr != nil && err == nil {
+			err = flushErr
+		}
+	}
+	return err
+}
+
+// Reopen reopens the files of the appenders by their paths, e.g. after moved by logrotate.
+// Files moved, deleted or truncated are also detected on writing within a second.
+func (l *PLogger) Reopen() error {
+	l.mu.Lock()
+	appenders := l.appendersLocked()
+	l.mu.Unlock()
+	var err error
+	for _, a := range appenders {
+		if r, ok := a.(interface{ Reopen() error }); ok {
+			if reopenErr := r.Reopen(); reopenErr != nil && err == nil {
+				err = reopenErr
+			}
+		}
+	}
+	return err
+}
+
+// ReopenOnSignal reopen the files on the signals, SIGHUP if none given, e.g. by the postrotate script of logrotate.
+// Call stop to stop handling.
+func (l *PLogger) ReopenOnSignal(sigs ...os.Signal) (stop func()) {
+	if len(sigs) == 0 {
+		sigs = []os.Signal{syscall.SIGHUP}
+	}
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, sigs...)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-ch:
+				if err := l.Reopen(); err != nil {
+					reportError(internalFailure, fmt.Errorf("reopen log files error, %v", err))
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			signal.Stop(ch)
+			close(done)
+		})
+	}
+}
+
+// syncWriter commits the writer to its storage if supported
+func syncWriter(w io.Writer) error {
+	if w == os.Stdout || w == os.Stderr {
+		// Console is not a storage, and sync fails on terminals and pipes
+		return nil
+	}
+	if s, ok := w.(interface{ Sync() error }); ok {
+		return s.Sync()
+	}
+	return nil
+}
+
+// closeWriter closes the writer if supported, except the console
+func closeWriter(w io.Writer) error {
+	if w == os.Stdout || w == os.Stderr {
+		return nil
+	}
+	if c, ok := w.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// SetName set logger name, e.g. com.app.db
+func (l *PLogger) SetName(name string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.name = name
+}
+
+// Name logger name
+func (l *PLogger) Name() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.name
+}
+
+// StartTrace start trace of the logger, cascading to the descendants which haven't started or stopped their own
 func (l *PLogger) StartTrace() {
-	l.isTraceEnable = true
+	hierarchyMu.Lock()
+	defer hierarchyMu.Unlock()
+	l.traceSet = true
+	l.cascadeTrace(1)
 }
 
-// StopTrace
+// StopTrace stop trace of the logger, cascading to the descendants which haven't started or stopped their own
 func (l *PLogger) StopTrace() {
-	l.isTraceEnable = false
+	hierarchyMu.Lock()
+	defer hierarchyMu.Unlock()
+	l.traceSet = true
+	l.cascadeTrace(0)
+}
+
+// GetLevel min level logged, safe to call while logging
+func (l *PLogger) GetLevel() LogLevel {
+	return LogLevel(atomic.LoadInt32((*int32)(&l.logLevel)))
+}
+
+// storeLevel set the level atomically
+func (l *PLogger) storeLevel(level LogLevel) {
+	atomic.StoreInt32((*int32)(&l.logLevel), int32(level))
+}
+
+// IsEnabled whether records of the level are logged, to skip building costly messages.
+// Trace level is enabled by StartTrace, the others by SetLevel.
+func (l *PLogger) IsEnabled(level LogLevel) bool {
+	if level == trace {
+		return atomic.LoadInt32(&l.isTraceEnable) != 0
+	}
+	return level >= l.GetLevel()
 }
 
 // Trace Log
 func (l *PLogger) Trace(format string, v ...interface{}) {
-	if !l.isTraceEnable {
+	if !l.IsEnabled(trace) {
 		return
 	}
 	l.Output(2, trace, fmt.Sprintf(format, v...))
@@ -497,7 +1061,7 @@ func (l *PLogger) Trace(format string, v ...interface{}) {
 
 // debug Log
 func (l *PLogger) Debug(format string, v ...interface{}) {
-	if l.logLevel > DEBUG {
+	if !l.IsEnabled(DEBUG) {
 		return
 	}
 	l.Output(2, DEBUG, fmt.Sprintf(format, v...))
@@ -505,7 +1069,7 @@ func (l *PLogger) Debug(format string, v ...interface{}) {
 
 // Info Log
 func (l *PLogger) Info(format string, v ...interface{}) {
-	if l.logLevel > INFO {
+	if !l.IsEnabled(INFO) {
 		return
 	}
 	l.Output(2, INFO, fmt.Sprintf(format, v...))
@@ -513,7 +1077,7 @@ func (l *PLogger) Info(format string, v ...interface{}) {
 
 // Warn Log
 func (l *PLogger) Warn(format string, v ...interface{}) {
-	if l.logLevel > WARN {
+	if !l.IsEnabled(WARN) {
 		return
 	}
 	l.Output(2, WARN, fmt.Sprintf(format, v...))
@@ -521,27 +1085,89 @@ func (l *PLogger) Warn(format string, v ...interface{}) {
 
 // Error Log
 func (l *PLogger) Error(format string, v ...interface{}) {
-	if l.logLevel > ERROR {
+	if !l.IsEnabled(ERROR) {
 		return
 	}
 	l.Output(2, ERROR, fmt.Sprintf(format, v...))
 }
 
 func (l *PLogger) Panic(format string, v ...interface{}) {
-	if l.logLevel > PANIC {
+	if !l.IsEnabled(PANIC) {
 		return
 	}
 	s := fmt.Sprintf(format, v...)
 	l.Output(2, PANIC, s)
+	l.Sync()
 	panic(s)
 }
 
-// Fatal
+// Fatal log, then close the logger to make sure logs reached disk and exit
 func (l *PLogger) Fatal(format string, v ...interface{}) {
-	if l.logLevel > FATAL {
+	if !l.IsEnabled(FATAL) {
 		return
 	}
 	l.Output(2, FATAL, fmt.Sprintf(format, v...))
+	l.Close()
+	os.Exit(1)
+}
+
+// Tracew structured Trace log with fields
+func (l *PLogger) Tracew(msg string, fields ...Field) {
+	if !l.IsEnabled(trace) {
+		return
+	}
+	l.output(2, trace, msg, fields)
+}
+
+// Debugw structured Debug log with fields
+func (l *PLogger) Debugw(msg string, fields ...Field) {
+	if !l.IsEnabled(DEBUG) {
+		return
+	}
+	l.output(2, DEBUG, msg, fields)
+}
+
+// Infow structured Info log with fields
+func (l *PLogger) Infow(msg string, fields ...Field) {
+	if !l.IsEnabled(INFO) {
+		return
+	}
+	l.output(2, INFO, msg, fields)
+}
+
+// Warnw structured Warn log with fields
+func (l *PLogger) Warnw(msg string, fields ...Field) {
+	if !l.IsEnabled(WARN) {
+		return
+	}
+	l.output(2, WARN, msg, fields)
+}
+
+// Errorw structured Error log with fields
+func (l *PLogger) Errorw(msg string, fields ...Field) {
+	if !l.IsEnabled(ERROR) {
+		return
+	}
+	l.output(2, ERROR, msg, fields)
+}
+
+// Panicw structured Panic log with fields
+func (l *PLogger) Panicw(msg string, fields ...Field) {
+	if !l.IsEnabled(PANIC) {
+		return
+	}
+	l.output(2, PANIC, msg, fields)
+	l.Sync()
+	panic(msg)
+}
+
+// Fatalw structured Fatal log with fields, then close the logger and exit
+func (l *PLogger) Fatalw(msg string, fields ...Field) {
+	if !l.IsEnabled(FATAL) {
+		return
+	}
+	l.output(2, FATAL, msg, fields)
+	l.Close()
 	os.Exit(1)
 }
 
@@ -561,15 +1187,34 @@ const (
 	defaultLogPath     = "./logs/app.log" // Default log path: ${app_path}/logs/app.log
 	defaultRotateCount = 7                // Default rotate file count.
 	defaultTraceOn     = true             // Default trace log flag is ON.
+	defaultFileMode    = 0644             // Default log file permission.
+
+	reopenCheckInterval = time.Second // Interval to check whether the file moved, deleted or truncated
+	rotateRetryInterval = time.Second // Interval to retry rotating or opening the file after failed
 )
 
 var (
 	defaultLogger, _ = GetLogger0(defaultLogPath)
 )
 
+// SetLevel set the level of the default logger, cascading to the named loggers which haven't set their own
+func SetLevel(level LogLevel) {
+	defaultLogger.SetLevel(level)
+}
+
+// GetLevel level of the default logger
+func GetLevel() LogLevel {
+	return defaultLogger.GetLevel()
+}
+
+// IsEnabled whether the default logger logs records of the level
+func IsEnabled(level LogLevel) bool {
+	return defaultLogger.IsEnabled(level)
+}
+
 // Trace Log
 func Trace(format string, v ...interface{}) {
-	if !defaultLogger.isTraceEnable {
+	if !defaultLogger.IsEnabled(trace) {
 		return
 	}
 	defaultLogger.Output(2, trace, fmt.Sprintf(format, v...))
@@ -577,7 +1222,7 @@ func Trace(format string, v ...interface{}) {
 
 // Debug Log
 func Debug(format string, v ...interface{}) {
-	if defaultLogger.logLevel > DEBUG {
+	if !defaultLogger.IsEnabled(DEBUG) {
 		return
 	}
 	defaultLogger.Output(2, DEBUG, fmt.Sprintf(format, v...))
@@ -585,7 +1230,7 @@ func Debug(format string, v ...interface{}) {
 
 // Info Log
 func Info(format string, v ...interface{}) {
-	if defaultLogger.logLevel > INFO {
+	if !defaultLogger.IsEnabled(INFO) {
 		return
 	}
 	defaultLogger.Output(2, INFO, fmt.Sprintf(format, v...))
@@ -593,7 +1238,7 @@ func Info(format string, v ...interface{}) {
 
 // Warn Log
 func Warn(format string, v ...interface{}) {
-	if defaultLogger.logLevel > WARN {
+	if !defaultLogger.IsEnabled(WARN) {
 		return
 	}
 	defaultLogger.Output(2, WARN, fmt.Sprintf(format, v...))
@@ -601,7 +1246,7 @@ func Warn(format string, v ...interface{}) {
 
 // Error Log
 func Error(format string, v ...interface{}) {
-	if defaultLogger.logLevel > ERROR {
+	if !defaultLogger.IsEnabled(ERROR) {
 		return
 	}
 	defaultLogger.Output(2, ERROR, fmt.Sprintf(format, v...))
@@ -609,19 +1254,89 @@ func Error(format string, v ...interface{}) {
 
 // Panic
 func Panic(format string, v ...interface{}) {
-	if defaultLogger.logLevel > PANIC {
+	if !defaultLogger.IsEnabled(PANIC) {
 		return
 	}
 	s := fmt.Sprintf(format, v...)
 	defaultLogger.Output(2, PANIC, s)
+	defaultLogger.Sync()
 	panic(s)
 }
 
-// Fatal
+// Fatal log, then shutdown to make sure logs reached disk and exit
 func Fatal(format string, v ...interface{}) {
-	if defaultLogger.logLevel > FATAL {
+	if !defaultLogger.IsEnabled(FATAL) {
 		return
 	}
 	defaultLogger.Output(2, FATAL, fmt.Sprintf(format, v...))
+	Shutdown()
+	os.Exit(1)
+}
+
+// Tracew structured Trace log with fields
+func Tracew(msg string, fields ...Field) {
+	if !defaultLogger.IsEnabled(trace) {
+		return
+	}
+	defaultLogger.output(2, trace, msg, fields)
+}
+
+// Debugw structured Debug log with fields
+func Debugw(msg string, fields ...Field) {
+	if !defaultLogger.IsEnabled(DEBUG) {
+		return
+	}
+	defaultLogger.output(2, DEBUG, msg, fields)
+}
+
+// Infow structured Info log with fields
+func Infow(msg string, fields ...Field) {
+	if !defaultLogger.IsEnabled(INFO) {
+		return
+	}
+	defaultLogger.output(2, INFO, msg, fields)
+}
+
+// Warnw structured Warn log with fields
+func Warnw(msg string, fields ...Field) {
+	if !defaultLogger.IsEnabled(WARN) {
+		return
+	}
+	defaultLogger.output(2, WARN, msg, fields)
+}
+
+// Errorw structured Error log with fields
+func Errorw(msg string, fields ...Field) {
+	if !defaultLogger.IsEnabled(ERROR) {
+		return
+	}
+	defaultLogger.output(2, ERROR, msg, fields)
+}
+
+// Panicw structured Panic log with fields
+func Panicw(msg string, fields ...Field) {
+	if !defaultLogger.IsEnabled(PANIC) {
+		return
+	}
+	defaultLogger.output(2, PANIC, msg, fields)
+	defaultLogger.Sync()
+	panic(msg)
+}
+
+// Fatalw structured Fatal log with fields, then shutdown and exit
+func Fatalw(msg string, fields ...Field) {
+	if !defaultLogger.IsEnabled(FATAL) {
+		return
+	}
+	defaultLogger.output(2, FATAL, msg, fields)
+	Shutdown()
 	os.Exit(1)
 }
+
+// Shutdown flushes and closes the default logger. Invoke once on application exit
+func Shutdown() error {
+	if defaultLogger == nil {
+		return nil
+	}
+	return defaultLogger.Close()
+}
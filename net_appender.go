@@ -0,0 +1,447 @@
+package p_log4go
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// ======== ======== PLogger: Network appender ======== ========
+
+// Framing how records are delimited on the wire
+type Framing int8
+
+const (
+	NewlineFraming      Framing = iota // Each record ends with '\n', use a single line formatter, e.g. JSONFormatter
+	LengthPrefixFraming                // Each record is prefixed by its length, a 4 bytes big endian uint32
+)
+
+// NetConf network appender conf
+type NetConf struct {
+	Network string  // tcp or udp
+	Addr    string  // Collector address, e.g. 127.0.0.1:5170
+	Framing Framing // NewlineFraming by default
+
+	// Records are spooled to the file while the collector is unavailable, and replayed on reconnect.
+	// Empty means records are dropped while unavailable.
+	SpoolPath   string
+	SpoolRotate RotateConf // Rotating and retention of the spool, which bounds its size. Daily if no interval.
+
+	MinBackoff   time.Duration // Reconnect backoff, doubled on each failure. 100ms by default
+	MaxBackoff   time.Duration // Max reconnect backoff, 30s by default
+	DialTimeout  time.Duration // 5s by default
+	WriteTimeout time.Duration // 5s by default
+}
+
+// NetAppender appender to a collector over tcp or udp. It reconnects with exponential backoff,
+// spools records while the collector is unavailable and replays them on reconnect.
+// Delivery is best effort, there are no acks: records written to a connection that breaks before the
+// collector reads them are lost, and a spool file interrupted while replaying may be partly replayed again.
+// A frame torn by a crash is dropped before spooling again, and a spool file with unreadable frames
+// is set aside as <path>.corrupt.<unix nano> and reported to the error handler.
+type NetAppender struct {
+	appenderLayout
+	conf NetConf
+
+	mu     sync.Mutex           // ensures atomic writes; protects the following fields
+	conn   net.Conn             // Connection, nil while the collector is unavailable
+	spool  *timedRotatingWriter // Spool file, opened when spooling is needed
+	line   []byte               // for accumulating the formatted record
+	buf    []byte               // for accumulating the frame to write
+	closed bool                 // whether closed
+
+	reconnecting bool          // Whether the reconnect goroutine is running
+	closeCh      chan struct{} // Closed when the appender is closed, stops reconnecting
+	wg           sync.WaitGroup
+}
+
+// NewNetAppender appender to the collector by the conf. The collector needn't be available yet,
+// it's dialed in background with backoff if the first dial fails.
+func NewNetAppender(conf NetConf) (*NetAppender, error) {
+	if conf.Network != "tcp" && conf.Network != "udp" {
+		return nil, fmt.Errorf("unsupported network %q", conf.Network)
+	}
+	if conf.Framing != NewlineFraming && conf.Framing != LengthPrefixFraming {
+		return nil, fmt.Errorf("unsupported framing %d", conf.Framing)
+	}
+	if conf.MinBackoff <= 0 {
+		conf.MinBackoff = 100 * time.Millisecond
+	}
+	if conf.MaxBackoff < conf.MinBackoff {
+		conf.MaxBackoff = 30 * time.Second
+		if conf.MaxBackoff < conf.MinBackoff {
+			conf.MaxBackoff = conf.MinBackoff
+		}
+	}
+	if conf.DialTimeout <= 0 {
+		conf.DialTimeout = 5 * time.Second
+	}
+	if conf.WriteTimeout <= 0 {
+		conf.WriteTimeout = 5 * time.Second
+	}
+	if conf.SpoolRotate.Interval == "" {
+		conf.SpoolRotate.Interval = Daily
+	}
+	if conf.SpoolRotate.Location == nil {
+		conf.SpoolRotate.Location = time.Local
+	}
+	// Spool archives are replayed as they are
+	conf.SpoolRotate.Compressor = nil
+	if conf.SpoolPath != "" {
+		if err := os.MkdirAll(filepath.Dir(conf.SpoolPath), 0755); err != nil {
+			return nil, fmt.Errorf("mkdir spool dir err, %v", err)
+		}
+	}
+
+	a := &NetAppender{conf: conf, closeCh: make(chan struct{})}
+	conn, err := net.DialTimeout(conf.Network, conf.Addr, conf.DialTimeout)
+	if err == nil {
+		// Records spooled by the previous process
+		err = a.resume(conn)
+	}
+	if err != nil {
+		a.mu.Lock()
+		a.startReconnect()
+		a.mu.Unlock()
+	}
+	return a, nil
+}
+
+// Append formats and frames the record, and sends it or spools it if the collector is unavailable
+func (a *NetAppender) Append(r *Record) error {
+	if r.Level < a.Level() {
+		return nil
+	}
+	formatter := a.formatterOf(r)
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.closed {
+		return ErrClosed
+	}
+	a.line = formatter.Format(a.line[:0], r)
+	a.buf = appendFrame(a.buf[:0], a.conf.Framing, a.line)
+	if a.conn != nil {
+		a.conn.SetWriteDeadline(time.Now().Add(a.conf.WriteTimeout))
+		if _, err := a.conn.Write(a.buf); err == nil {
+			return nil
+		}
+		// Collector unavailable, spool the record and reconnect in background
+		a.conn.Close()
+		a.conn = nil
+		a.startReconnect()
+	}
+	return a.spoolFrame(a.buf)
+}
+
+// spoolFrame write the frame to the spool file. a.mu must be held.
+func (a *NetAppender) spoolFrame(frame []byte) error {
+	if a.conf.SpoolPath == "" {
+		return errors.New("collector unavailable, record dropped")
+	}
+	if a.spool == nil {
+		// Frames appended after a torn one would be misaligned
+		if err := repairSpool(a.conf.SpoolPath, a.conf.Framing); err != nil {
+			return err
+		}
+		spool, err := newTimedRotateWriter(a.conf.SpoolPath, a.conf.SpoolRotate)
+		if err != nil {
+			return err
+		}
+		a.spool = spool
+	}
+	_, err := a.spool.Write(frame)
+	return err
+}
+
+// startReconnect start the reconnect goroutine if not running. a.mu must be held.
+func (a *NetAppender) startReconnect() {
+	if a.reconnecting || a.closed {
+		return
+	}
+	a.reconnecting = true
+	a.wg.Add(1)
+	go a.reconnect()
+}
+
+// reconnect dial with exponential backoff until connected or closed, then replay the spool
+func (a *NetAppender) reconnect() {
+	defer a.wg.Done()
+	backoff := a.conf.MinBackoff
+	for {
+		select {
+		case <-a.closeCh:
+			return
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > a.conf.MaxBackoff {
+			backoff = a.conf.MaxBackoff
+		}
+		conn, err := net.DialTimeout(a.conf.Network, a.conf.Addr, a.conf.DialTimeout)
+		if err != nil {
+			continue
+		}
+		if err = a.resume(conn); err == ErrClosed {
+			return
+		} else if err != nil {
+			if _, ok := err.(net.Error); !ok {
+				// Not the collector gone again, e.g. the spool dir unreadable
+				reportError(writeFailure, fmt.Errorf("replay spool %s error, %v", a.conf.SpoolPath, err))
+			}
+			continue
+		}
+		return
+	}
+}
+
+// resume replay the spool to the connection, then append to it. Archives are replayed without a.mu, records
+// appended meanwhile are spooled, and the rest is replayed holding a.mu before switching, to keep the order.
+// The connection is closed if failed.
+func (a *NetAppender) resume(conn net.Conn) error {
+	archives, err := a.spoolArchives()
+	if err == nil {
+		err = a.replayFiles(conn, archives)
+	}
+	if err != nil {
+		conn.Close()
+		return err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.closed {
+		conn.Close()
+		return ErrClosed
+	}
+	if err = a.replaySpool(conn); err != nil {
+		conn.Close()
+		return err
+	}
+	a.conn = conn
+	a.reconnecting = false
+	return nil
+}
+
+// replaySpool send the spooled frames oldest first, and remove the spool files sent. a.mu must be held.
+func (a *NetAppender) replaySpool(conn net.Conn) error {
+	if a.conf.SpoolPath == "" {
+		return nil
+	}
+	if a.spool != nil {
+		if err := a.spool.Close(); err != nil {
+			return err
+		}
+		a.spool = nil
+	}
+	archives, err := a.spoolArchives()
+	if err != nil {
+		return err
+	}
+	return a.replayFiles(conn, append(archives, a.conf.SpoolPath))
+}
+
+// spoolArchives paths of the spool archives, oldest first
+func (a *NetAppender) spoolArchives() ([]string, error) {
+	if a.conf.SpoolPath == "" {
+		return nil, nil
+	}
+	// List archives by a writer of the spool path, without opening the file
+	w := &timedRotatingWriter{filename: a.conf.SpoolPath, location: a.conf.SpoolRotate.Location}
+	w.setInterval(a.conf.SpoolRotate.Interval)
+	archives, err := w.listArchives()
+	if err != nil {
+		return nil, err
+	}
+	paths := make([]string, 0, len(archives)+1)
+	for i := len(archives) - 1; i >= 0; i-- {
+		paths = append(paths, archives[i].path)
+	}
+	return paths, nil
+}
+
+// replayFiles send the frames of the spool files in order, and remove each sent
+func (a *NetAppender) replayFiles(conn net.Conn, paths []string) error {
+	for _, path := range paths {
+		if err := a.replayFile(conn, path); err != nil {
+			return err
+		}
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// replayFile send the frames of the spool file. A file whose frames can't be read is set aside as
+// <path>.corrupt.<unix nano> and reported, not to block the others.
+func (a *NetAppender) replayFile(conn net.Conn, path string) error {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 16<<20)
+	scanner.Split(frameSplitter(a.conf.Framing))
+	for scanner.Scan() {
+		select {
+		case <-a.closeCh:
+			// Replayed again by the next process
+			return ErrClosed
+		default:
+		}
+		conn.SetWriteDeadline(time.Now().Add(a.conf.WriteTimeout))
+		if _, err = conn.Write(scanner.Bytes()); err != nil {
+			return err
+		}
+	}
+	if scanErr := scanner.Err(); scanErr != nil {
+		f.Close()
+		quarantined := fmt.Sprintf("%s.corrupt.%d", path, time.Now().UnixNano())
+		if err = os.Rename(path, quarantined); err != nil {
+			return err
+		}
+		reportError(writeFailure, fmt.Errorf("spool file %s corrupt, moved to %s with the frames before it sent, %v",
+			path, quarantined, scanErr))
+	}
+	return nil
+}
+
+// repairSpool drop the torn frame at the end of the spool file left by a crash, or terminate the torn line,
+// before frames are appended to it
+func repairSpool(path string, framing Framing) error {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil || info.Size() == 0 {
+		return err
+	}
+	size := info.Size()
+	if framing == NewlineFraming {
+		last := make([]byte, 1)
+		if _, err = f.ReadAt(last, size-1); err != nil || last[0] == '\n' {
+			return err
+		}
+		_, err = f.WriteAt([]byte{'\n'}, size)
+		return err
+	}
+	// Walk the lengths to the end of the last whole frame
+	r := bufio.NewReader(f)
+	var end int64
+	var length [4]byte
+	for {
+		if _, err = io.ReadFull(r, length[:]); err != nil {
+			break
+		}
+		n := int64(binary.BigEndian.Uint32(length[:]))
+		if end+4+n > size {
+			break
+		}
+		if _, err = r.Discard(int(n)); err != nil {
+			break
+		}
+		end += 4 + n
+	}
+	if end == size {
+		return nil
+	}
+	return f.Truncate(end)
+}
+
+// Flush commits the spool file to disk
+func (a *NetAppender) Flush() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.spool != nil {
+		return a.spool.Sync()
+	}
+	return nil
+}
+
+// Close stops reconnecting, closes the connection and the spool. Spooled records are replayed by the next process.
+func (a *NetAppender) Close() error {
+	a.mu.Lock()
+	if a.closed {
+		a.mu.Unlock()
+		return nil
+	}
+	a.closed = true
+	close(a.closeCh)
+	a.mu.Unlock()
+	a.wg.Wait()
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	var err error
+	if a.conn != nil {
+		err = a.conn.Close()
+	}
+	if a.spool != nil {
+		if spoolErr := a.spool.Close(); spoolErr != nil && err == nil {
+			err = spoolErr
+		}
+	}
+	return err
+}
+
+// appendFrame append the record to buf framed
+func appendFrame(buf []byte, framing Framing, record []byte) []byte {
+	if framing == LengthPrefixFraming {
+		var length [4]byte
+		binary.BigEndian.PutUint32(length[:], uint32(len(record)))
+		buf = append(buf, length[:]...)
+		return append(buf, record...)
+	}
+	buf = append(buf, record...)
+	if len(record) == 0 || record[len(record)-1] != '\n' {
+		buf = append(buf, '\n')
+	}
+	return buf
+}
+
+// errTornFrame the spool ends in the middle of a length prefixed frame
+var errTornFrame = errors.New("torn frame at the end")
+
+// frameSplitter split func of frames, each token is a whole frame including the delimiter or length
+func frameSplitter(framing Framing) bufio.SplitFunc {
+	if framing == LengthPrefixFraming {
+		return func(data []byte, atEOF bool) (int, []byte, error) {
+			if len(data) < 4 {
+				return 0, nil, nil
+			}
+			n := 4 + int(binary.BigEndian.Uint32(data))
+			if len(data) < n {
+				if atEOF {
+					// Truncated by a crash when spooling, or misaligned
+					return 0, nil, errTornFrame
+				}
+				return 0, nil, nil
+			}
+			return n, data[:n], nil
+		}
+	}
+	return func(data []byte, atEOF bool) (int, []byte, error) {
+		if i := bytes.IndexByte(data, '\n'); i >= 0 {
+			return i + 1, data[:i+1], nil
+		}
+		if atEOF && len(data) > 0 {
+			// Truncated by a crash when spooling, terminated to keep the next frame apart
+			return len(data), append(data[:len(data):len(data)], '\n'), nil
+		}
+		return 0, nil, nil
+	}
+}
@@ -0,0 +1,325 @@
+package p_log4go
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// lineCollector a tcp collector receiving newline framed records, which can go down and up
+type lineCollector struct {
+	addr  string
+	ln    net.Listener
+	lines chan string
+	mu    sync.Mutex
+	conns []net.Conn
+}
+
+func (c *lineCollector) up(t *testing.T) {
+	ln, err := net.Listen("tcp", c.addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.ln, c.addr = ln, ln.Addr().String()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			c.mu.Lock()
+			c.conns = append(c.conns, conn)
+			c.mu.Unlock()
+			go func() {
+				scanner := bufio.NewScanner(conn)
+				for scanner.Scan() {
+					c.lines <- scanner.Text()
+				}
+			}()
+		}
+	}()
+}
+
+// down stops accepting, and closes the accepted connections
+func (c *lineCollector) down() {
+	c.ln.Close()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, conn := range c.conns {
+		conn.Close()
+	}
+	c.conns = nil
+}
+
+// expect the lines received in order, skipping others
+func (c *lineCollector) expect(t *testing.T, wants ...string) {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for _, want := range wants {
+		for received := false; !received; {
+			select {
+			case line := <-c.lines:
+				received = strings.HasSuffix(line, " "+want)
+			case <-timeout:
+				t.Fatalf("%q not received", want)
+			}
+		}
+	}
+}
+
+func TestNetAppenderReconnectAndSpool(t *testing.T) {
+	dir, err := ioutil.TempDir("", "plog4go-net")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	spoolPath := filepath.Join(dir, "spool", "net.spool")
+
+	collector := &lineCollector{addr: "127.0.0.1:0", lines: make(chan string, 100)}
+	collector.up(t)
+	appender, err := NewNetAppender(NetConf{Network: "tcp", Addr: collector.addr, SpoolPath: spoolPath,
+		MinBackoff: 10 * time.Millisecond, MaxBackoff: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	netLogger := &PLogger{logLevel: DEBUG}
+	netLogger.AttachAppender(appender)
+	defer netLogger.Close()
+
+	netLogger.Info("up 1")
+	collector.expect(t, "up 1")
+
+	// Records written before the broken connection is detected are lost, until then keep logging
+	collector.down()
+	waitFor(t, 5*time.Second, func() bool {
+		netLogger.Info("detecting")
+		time.Sleep(5 * time.Millisecond)
+		appender.mu.Lock()
+		defer appender.mu.Unlock()
+		return appender.conn == nil
+	})
+	netLogger.Info("spooled 1")
+	netLogger.Info("spooled 2")
+	if data, err := ioutil.ReadFile(spoolPath); err != nil || !bytes.HasSuffix(data, []byte(" spooled 1\n[INFO] spooled 2\n")) {
+		t.Fatalf("got spool %q, %v", data, err)
+	}
+
+	// Spooled records are replayed on reconnect, before the new ones
+	collector.up(t)
+	defer collector.down()
+	waitFor(t, 5*time.Second, func() bool {
+		appender.mu.Lock()
+		defer appender.mu.Unlock()
+		return appender.conn != nil
+	})
+	netLogger.Info("up 2")
+	collector.expect(t, "spooled 1", "spooled 2", "up 2")
+	if _, err := os.Stat(spoolPath); !os.IsNotExist(err) {
+		t.Errorf("spool should be removed after replayed, %v", err)
+	}
+}
+
+func TestNetAppenderReplayOnStart(t *testing.T) {
+	dir, err := ioutil.TempDir("", "plog4go-net")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	spoolPath := filepath.Join(dir, "net.spool")
+	// Spooled by the previous process: a daily archive, then the current file
+	yesterday := time.Now().AddDate(0, 0, -1).Format("2006-01-02")
+	if err := ioutil.WriteFile(spoolPath+"."+yesterday, []byte("[INFO] archived\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(spoolPath, []byte("[INFO] current\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	collector := &lineCollector{addr: "127.0.0.1:0", lines: make(chan string, 100)}
+	collector.up(t)
+	defer collector.down()
+	appender, err := NewNetAppender(NetConf{Network: "tcp", Addr: collector.addr, SpoolPath: spoolPath})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer appender.Close()
+	appender.Append(&Record{Level: INFO, Message: "new"})
+	collector.expect(t, "archived", "current", "new")
+}
+
+func TestFrameSplitter(t *testing.T) {
+	for _, framing := range []Framing{NewlineFraming, LengthPrefixFraming} {
+		var data []byte
+		records := []string{"a\n", "bb", "", "ccc\n"}
+		for _, r := range records {
+			data = appendFrame(data, framing, []byte(r))
+		}
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		scanner.Split(frameSplitter(framing))
+		var frames []byte
+		n := 0
+		for scanner.Scan() {
+			frames = append(frames, scanner.Bytes()...)
+			n++
+		}
+		if n != len(records) || !bytes.Equal(frames, data) {
+			t.Errorf("framing %d got %d frames %q, want %d frames %q", framing, n, frames, len(records), data)
+		}
+	}
+}
+
+func TestSpoolRepairAndQuarantine(t *testing.T) {
+	dir, err := ioutil.TempDir("", "plog4go-net")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	spoolPath := filepath.Join(dir, "net.spool")
+
+	// Crashed in the middle of a frame, then the next process appends
+	for _, framing := range []Framing{NewlineFraming, LengthPrefixFraming} {
+		torn := appendFrame(nil, framing, []byte("torn record\n"))
+		data := appendFrame(nil, framing, []byte("a\n"))
+		data = append(data, torn[:6]...)
+		if err = ioutil.WriteFile(spoolPath, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err = repairSpool(spoolPath, framing); err != nil {
+			t.Fatal(err)
+		}
+		f, _ := os.OpenFile(spoolPath, os.O_WRONLY|os.O_APPEND, 0)
+		f.Write(appendFrame(nil, framing, []byte("b\n")))
+		f.Close()
+
+		data, _ = ioutil.ReadFile(spoolPath)
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		scanner.Split(frameSplitter(framing))
+		var frames []string
+		for scanner.Scan() {
+			frames = append(frames, string(scanner.Bytes()))
+		}
+		if err = scanner.Err(); err != nil || len(frames) == 0 || !strings.HasSuffix(frames[len(frames)-1], "b\n") {
+			t.Errorf("framing %d got frames %q, %v, want b last", framing, frames, err)
+		}
+	}
+
+	// Misaligned frames are set aside and reported, not retried forever
+	var reported []error
+	SetErrorHandler(func(err error) { reported = append(reported, err) })
+	defer SetErrorHandler(nil)
+	data := appendFrame(nil, LengthPrefixFraming, []byte("a\n"))
+	data = append(data, 0, 0, 1, 0, 'x')
+	if err = ioutil.WriteFile(spoolPath, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	client, server := net.Pipe()
+	defer server.Close()
+	go ioutil.ReadAll(server)
+	appender := &NetAppender{conf: NetConf{Framing: LengthPrefixFraming, WriteTimeout: time.Second}, closeCh: make(chan struct{})}
+	if err = appender.replayFile(client, spoolPath); err != nil {
+		t.Errorf("got err %v, want nil after quarantined", err)
+	}
+	client.Close()
+	quarantined, _ := filepath.Glob(spoolPath + ".corrupt.*")
+	if _, err = os.Stat(spoolPath); !os.IsNotExist(err) || len(quarantined) != 1 || len(reported) != 1 {
+		t.Errorf("got quarantined %v, reported %v, want the spool moved aside and reported", quarantined, reported)
+	}
+}
+
+// TestNetAppenderAppendWhileReplaying appending isn't blocked by replaying a large spool on reconnect
+func TestNetAppenderAppendWhileReplaying(t *testing.T) {
+	dir, err := ioutil.TempDir("", "plog4go-net")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	spoolPath := filepath.Join(dir, "net.spool")
+	const archived = 200000
+	yesterday := time.Now().AddDate(0, 0, -1).Format("2006-01-02")
+	line := "[INFO] archived " + strings.Repeat("x", 100) + "\n"
+	if err = ioutil.WriteFile(spoolPath+"."+yesterday, bytes.Repeat([]byte(line), archived), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// The collector is down first
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+	appender, err := NewNetAppender(NetConf{Network: "tcp", Addr: addr, SpoolPath: spoolPath,
+		MinBackoff: 10 * time.Millisecond, MaxBackoff: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer appender.Close()
+
+	// Then up, but doesn't read until released, so replaying blocks
+	if ln, err = net.Listen("tcp", addr); err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	accepted, release := make(chan struct{}), make(chan struct{})
+	lines := make(chan string, 100)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		close(accepted)
+		<-release
+		scanner := bufio.NewScanner(conn)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+	}()
+	<-accepted
+	time.Sleep(100 * time.Millisecond)
+	appended := make(chan struct{})
+	go func() {
+		appender.Append(&Record{Level: INFO, Message: "while replaying"})
+		close(appended)
+	}()
+	select {
+	case <-appended:
+	case <-time.After(2 * time.Second):
+		t.Error("append blocked by replaying")
+	}
+	close(release)
+
+	var tail []string
+	timeout := time.After(10 * time.Second)
+	receive := func(n int) {
+		t.Helper()
+		for i := 0; i < n; i++ {
+			select {
+			case got := <-lines:
+				if !strings.HasSuffix(got, " archived "+strings.Repeat("x", 100)) {
+					tail = append(tail, got)
+				}
+			case <-timeout:
+				t.Fatalf("got %d of %d lines", i, n)
+			}
+		}
+	}
+	receive(archived + 1)
+	waitFor(t, 5*time.Second, func() bool {
+		appender.mu.Lock()
+		defer appender.mu.Unlock()
+		return appender.conn != nil
+	})
+	appender.Append(&Record{Level: INFO, Message: "new"})
+	receive(1)
+	if got := strings.Join(tail, "|"); len(tail) != 2 || !strings.HasSuffix(tail[0], " while replaying") || !strings.HasSuffix(got, " new") {
+		t.Errorf("got tail %q, want the spooled record before the new one", got)
+	}
+}
@@ -0,0 +1,189 @@
+package p_log4go
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// ======== ======== PLogger: Functional options ======== ========
+
+// Option configures the logger built by New
+type Option func(*loggerOptions)
+
+// loggerOptions settings of New, defaults as GetLogger0
+type loggerOptions struct {
+	filePath   string
+	level      LogLevel
+	traceOn    bool
+	rotateConf RotateConf
+	appender   AppenderFlag
+	appenders  []Appender
+	flag       int
+	prefix     string
+}
+
+// New get logger by the options, e.g.
+//
+//	logger, err := New(WithFile("./logs/app.log"), WithLevel(INFO), WithRotate(30), WithFileMode(0600))
+//
+// By default it logs DEBUG and above with trace on, to ./logs/app.log rotated daily keeping 7 archives,
+// with flag bits Ldate | Ltime | Lmicroseconds | Lshortfile.
+func New(opts ...Option) (*PLogger, error) {
+	o := loggerOptions{
+		filePath:   defaultLogPath,
+		level:      DEBUG,
+		traceOn:    defaultTraceOn,
+		rotateConf: RotateConf{Interval: Daily, Rotate: defaultRotateCount},
+		appender:   FileAppender,
+		flag:       Ldate | Ltime | Lmicroseconds | Lshortfile,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if err := o.validate(); err != nil {
+		return nil, err
+	}
+
+	// Records are fanned out to each appender, by its own level and formatter
+	var appenders = make([]Appender, 0, len(o.appenders)+2)
+
+	if o.appender&FileAppender != 0 {
+		fileAppender, err := NewFileAppender(o.filePath, o.rotateConf)
+		if err != nil {
+			return nil, fmt.Errorf("create RotateRiter err, %v", err)
+		}
+		appenders = append(appenders, fileAppender)
+	}
+
+	if o.appender&ConsoleAppender != 0 {
+		appenders = append(appenders, NewColorConsoleAppender(ConsoleConf{}))
+	}
+
+	l := &PLogger{
+		logLevel:  o.level,
+		prefix:    o.prefix,
+		flag:      o.flag,
+		appenders: append(appenders, o.appenders...),
+	}
+	if o.traceOn {
+		l.StartTrace()
+	}
+	return l, nil
+}
+
+// validate the options
+func (o *loggerOptions) validate() error {
+	if o.level < trace || o.level > FATAL {
+		return fmt.Errorf("invalid level %d, must be between TRACE and FATAL", o.level)
+	}
+	switch o.rotateConf.Interval {
+	case Hourly, Daily, Weekly:
+	default:
+		return fmt.Errorf("invalid rotate interval %q, must be one of Hourly, Daily, Weekly", o.rotateConf.Interval)
+	}
+	if o.rotateConf.Rotate < 0 {
+		return fmt.Errorf("invalid rotate count %d, must not be negative", o.rotateConf.Rotate)
+	}
+	if o.appender&^(FileAppender|ConsoleAppender) != 0 {
+		return fmt.Errorf("invalid appender flag %d, must be of FileAppender, ConsoleAppender", o.appender)
+	}
+	if o.appender == 0 && len(o.appenders) == 0 {
+		return fmt.Errorf("no appender, set by WithAppender or WithAppenders")
+	}
+	if o.appender&FileAppender != 0 && o.filePath == "" {
+		return fmt.Errorf("file path not set for FileAppender")
+	}
+	if o.flag < 0 || o.flag >= Lmsgprefix<<1 {
+		return fmt.Errorf("invalid flag bits %#x", o.flag)
+	}
+	if mode := o.rotateConf.FileMode; mode&^os.ModePerm != 0 || (mode != 0 && mode&0200 == 0) {
+		return fmt.Errorf("invalid file mode %v, must be permission bits writable by the owner", mode)
+	}
+	return nil
+}
+
+// WithFile log file path, ./logs/app.log by default
+func WithFile(filePath string) Option {
+	return func(o *loggerOptions) {
+		o.filePath = filePath
+	}
+}
+
+// WithLevel min level logged, DEBUG by default
+func WithLevel(level LogLevel) Option {
+	return func(o *loggerOptions) {
+		o.level = level
+	}
+}
+
+// WithTrace whether Trace logs, true by default
+func WithTrace(traceOn bool) Option {
+	return func(o *loggerOptions) {
+		o.traceOn = traceOn
+	}
+}
+
+// WithInterval file rotating interval, Daily by default
+func WithInterval(interval RotateInterval) Option {
+	return func(o *loggerOptions) {
+		o.rotateConf.Interval = interval
+	}
+}
+
+// WithRotate rotated periods kept, 7 by default
+func WithRotate(rotate int64) Option {
+	return func(o *loggerOptions) {
+		o.rotateConf.Rotate = rotate
+	}
+}
+
+// WithRotateConf the whole rotate conf, e.g. to rotate by size too. It overrides the interval, rotate count
+// and file mode set before.
+func WithRotateConf(conf RotateConf) Option {
+	return func(o *loggerOptions) {
+		o.rotateConf = conf
+	}
+}
+
+// WithFileMode permission of the log files before umask, 0644 by default
+func WithFileMode(mode os.FileMode) Option {
+	return func(o *loggerOptions) {
+		o.rotateConf.FileMode = mode
+	}
+}
+
+// WithLocation location of the calendar rotating by, time.Local by default
+func WithLocation(location *time.Location) Option {
+	return func(o *loggerOptions) {
+		o.rotateConf.Location = location
+	}
+}
+
+// WithAppender built-in appenders by flag, FileAppender by default, e.g. FileAppender | ConsoleAppender
+func WithAppender(appender AppenderFlag) Option {
+	return func(o *loggerOptions) {
+		o.appender = appender
+	}
+}
+
+// WithAppenders more appenders after the built-in ones, e.g. NewSyslogAppender. Use WithAppender(0) for these only.
+func WithAppenders(appenders ...Appender) Option {
+	return func(o *loggerOptions) {
+		o.appenders = append(o.appenders, appenders...)
+	}
+}
+
+// WithFlags flag bits of the lines, Ldate | Ltime | Lmicroseconds | Lshortfile by default
+func WithFlags(flag int) Option {
+	return func(o *loggerOptions) {
+		o.flag = flag
+	}
+}
+
+// WithPrefix prefix of the lines, see Lmsgprefix
+func WithPrefix(prefix string) Option {
+	return func(o *loggerOptions) {
+		o.prefix = prefix
+	}
+}
@@ -0,0 +1,64 @@
+package p_log4go
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestNew(t *testing.T) {
+	dir, err := ioutil.TempDir("", "plog-options")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	logPath := filepath.Join(dir, "app.log")
+
+	var buf bytes.Buffer
+	oldMask := syscall.Umask(0)
+	optionsLogger, err := New(WithFile(logPath), WithLevel(INFO), WithFileMode(0600), WithFlags(Lmsgprefix),
+		WithPrefix("svc: "), WithAppenders(NewWriterAppender(&buf)))
+	syscall.Umask(oldMask)
+	if err != nil {
+		t.Fatal(err)
+	}
+	optionsLogger.Debug("Shouldn't see this")
+	optionsLogger.Info("hello")
+	optionsLogger.Close()
+
+	if got, want := buf.String(), "[INFO] svc: hello\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	info, err := os.Stat(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("got file mode %v, want 0600", info.Mode().Perm())
+	}
+}
+
+func TestNewInvalid(t *testing.T) {
+	tests := []struct {
+		opts []Option
+		want string
+	}{
+		{[]Option{WithLevel(FATAL + 1)}, "invalid level"},
+		{[]Option{WithInterval("Monthly")}, "invalid rotate interval"},
+		{[]Option{WithRotate(-1)}, "invalid rotate count"},
+		{[]Option{WithAppender(0)}, "no appender"},
+		{[]Option{WithAppender(4)}, "invalid appender flag"},
+		{[]Option{WithFile("")}, "file path not set"},
+		{[]Option{WithFlags(Lmsgprefix << 1)}, "invalid flag bits"},
+		{[]Option{WithFileMode(0444)}, "invalid file mode"},
+	}
+	for _, tt := range tests {
+		if _, err := New(tt.opts...); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("got err %v, want %s", err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,505 @@
+package p_log4go
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// ======== ======== PLogger: Pattern layout ======== ========
+
+// PatternLayout log4j style pattern layout, e.g.
+//
+//	%d{yyyy-MM-dd HH:mm:ss.SSS} [%-5p] %c %F:%L - %m%n
+//
+// The pattern is compiled once to a sequence of segment writers, nothing is parsed when logging.
+// Conversions:
+//
+//	%d{format}{zone}  date, format in SimpleDateFormat letters or ISO8601/ABSOLUTE/DATE, default yyyy-MM-dd HH:mm:ss,SSS
+//	%p                level
+//	%c{n}             logger name, the rightmost n components if n set
+//	%F %L             caller file and line
+//	%M                caller function
+//	%t                goroutine id
+//	%m                message
+//	%X{key}           value of the field, all fields if no key
+//	%n %%             newline and percent
+//
+// Long names such as %date %level %logger %file %line %method %thread %msg are also accepted.
+// Format modifiers pad and truncate: %-5p pads right to 5 chars, %5p pads left, %.10c keeps the last 10 chars.
+type PatternLayout struct {
+	pattern  string
+	segments []patternSegment
+	needs    recordNeed
+}
+
+// patternConverter appends a part of the record to buf
+type patternConverter func(buf []byte, r *Record) []byte
+
+// patternSegment a literal or a conversion with its format modifiers
+type patternSegment struct {
+	convert   patternConverter
+	level     bool // Whether it's the level conversion, see formatLevelAt
+	leftAlign bool // Pad right if true
+	minWidth  int  // Pad to min width if > 0
+	maxWidth  int  // Truncate from the beginning to max width if > 0
+}
+
+// patternConverterFactory compiles a conversion with its {options}
+type patternConverterFactory func(options []string) (patternConverter, recordNeed, error)
+
+// patternConverters conversion names to their factories
+var patternConverters = map[string]patternConverterFactory{
+	"d": dateConverter, "date": dateConverter,
+	"p": levelConverter, "level": levelConverter,
+	"c": loggerConverter, "logger": loggerConverter,
+	"F": fileConverter, "file": fileConverter,
+	"L": lineConverter, "line": lineConverter,
+	"M": functionConverter, "method": functionConverter,
+	"t": goroutineConverter, "thread": goroutineConverter,
+	"m": messageConverter, "msg": messageConverter, "message": messageConverter,
+	"X": fieldsConverter, "mdc": fieldsConverter,
+	"n": newlineConverter,
+}
+
+// NewPatternLayout compile the pattern
+func NewPatternLayout(pattern string) (*PatternLayout, error) {
+	layout := &PatternLayout{pattern: pattern}
+	var literal []byte
+	flushLiteral := func() {
+		if len(literal) > 0 {
+			text := string(literal)
+			layout.segments = append(layout.segments, patternSegment{convert: func(buf []byte, r *Record) []byte {
+				return append(buf, text...)
+			}})
+			literal = nil
+		}
+	}
+
+	for i := 0; i < len(pattern); {
+		if pattern[i] != '%' {
+			literal = append(literal, pattern[i])
+			i++
+			continue
+		}
+		i++
+		if i >= len(pattern) {
+			return nil, fmt.Errorf("pattern %q ends with %%", pattern)
+		}
+		if pattern[i] == '%' {
+			literal = append(literal, '%')
+			i++
+			continue
+		}
+
+		// Format modifiers
+		segment := patternSegment{}
+		if pattern[i] == '-' {
+			segment.leftAlign = true
+			i++
+		}
+		segment.minWidth, i = parseDigits(pattern, i)
+		if i < len(pattern) && pattern[i] == '.' {
+			if segment.maxWidth, i = parseDigits(pattern, i+1); segment.maxWidth <= 0 {
+				return nil, fmt.Errorf("pattern %q has invalid max width at %d", pattern, i)
+			}
+		}
+
+		// Conversion name, the longest known one, the rest letters are literal
+		start := i
+		for i < len(pattern) && isASCIILetter(pattern[i]) {
+			i++
+		}
+		name := pattern[start:i]
+		for len(name) > 0 && patternConverters[name] == nil {
+			name = name[:len(name)-1]
+		}
+		if name == "" {
+			return nil, fmt.Errorf("pattern %q has unknown conversion at %d", pattern, start)
+		}
+		i = start + len(name)
+
+		// Options {...}{...}
+		var options []string
+		for i < len(pattern) && pattern[i] == '{' {
+			end := strings.IndexByte(pattern[i:], '}')
+			if end < 0 {
+				return nil, fmt.Errorf("pattern %q has unclosed { at %d", pattern, i)
+			}
+			options = append(options, pattern[i+1:i+end])
+			i += end + 1
+		}
+
+		convert, needs, err := patternConverters[name](options)
+		if err != nil {
+			return nil, fmt.Errorf("pattern %q conversion %%%s, %v", pattern, name, err)
+		}
+		flushLiteral()
+		segment.convert = convert
+		segment.level = name == "p" || name == "level"
+		layout.needs |= needs
+		layout.segments = append(layout.segments, segment)
+	}
+	flushLiteral()
+	return layout, nil
+}
+
+// MustPatternLayout compile the pattern, panics if it's invalid
+func MustPatternLayout(pattern string) *PatternLayout {
+	layout, err := NewPatternLayout(pattern)
+	if err != nil {
+		panic(err)
+	}
+	return layout
+}
+
+// String the pattern
+func (p *PatternLayout) String() string {
+	return p.pattern
+}
+
+// Format the record by the compiled segments
+func (p *PatternLayout) Format(buf []byte, r *Record) []byte {
+	buf, _ = p.formatLevelAt(buf, r)
+	return buf
+}
+
+// formatLevelAt format the record, and return where the first %p put the level name, -1 if none or truncated
+func (p *PatternLayout) formatLevelAt(buf []byte, r *Record) ([]byte, int) {
+	levelAt := -1
+	for i := range p.segments {
+		segment := &p.segments[i]
+		if segment.minWidth == 0 && segment.maxWidth == 0 {
+			if segment.level && levelAt < 0 {
+				levelAt = len(buf)
+			}
+			buf = segment.convert(buf, r)
+			continue
+		}
+
+		start := len(buf)
+		buf = segment.convert(buf, r)
+		n := utf8.RuneCount(buf[start:])
+		if segment.maxWidth > 0 && n > segment.maxWidth {
+			cut := start
+			for k := n - segment.maxWidth; k > 0; k-- {
+				_, size := utf8.DecodeRune(buf[cut:])
+				cut += size
+			}
+			buf = append(buf[:start], buf[cut:]...)
+			n = segment.maxWidth
+		}
+		if pad := segment.minWidth - n; pad > 0 {
+			end := len(buf)
+			for k := 0; k < pad; k++ {
+				buf = append(buf, ' ')
+			}
+			if !segment.leftAlign {
+				copy(buf[start+pad:], buf[start:end])
+				for k := start; k < start+pad; k++ {
+					buf[k] = ' '
+				}
+			}
+		}
+		if segment.level && levelAt < 0 {
+			if k := bytes.Index(buf[start:], []byte(r.Level.String())); k >= 0 {
+				levelAt = start + k
+			}
+		}
+	}
+	return buf, levelAt
+}
+
+// recordNeeds record info needed by the conversions
+func (p *PatternLayout) recordNeeds() recordNeed {
+	return p.needs
+}
+
+func parseDigits(s string, i int) (int, int) {
+	n := 0
+	for ; i < len(s) && s[i] >= '0' && s[i] <= '9'; i++ {
+		n = n*10 + int(s[i]-'0')
+	}
+	return n, i
+}
+
+func isASCIILetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func levelConverter(options []string) (patternConverter, recordNeed, error) {
+	return func(buf []byte, r *Record) []byte {
+		return append(buf, r.Level.String()...)
+	}, 0, nil
+}
+
+// loggerConverter %c{n} the rightmost n components of the logger name
+func loggerConverter(options []string) (patternConverter, recordNeed, error) {
+	precision := 0
+	if len(options) > 0 && options[0] != "" {
+		var err error
+		if precision, err = strconv.Atoi(options[0]); err != nil || precision <= 0 {
+			return nil, 0, fmt.Errorf("invalid precision %q", options[0])
+		}
+	}
+	return func(buf []byte, r *Record) []byte {
+		name := r.Logger
+		if precision > 0 {
+			for i, dots := len(name)-1, 0; i >= 0; i-- {
+				if name[i] == '.' {
+					if dots++; dots == precision {
+						name = name[i+1:]
+						break
+					}
+				}
+			}
+		}
+		return append(buf, name...)
+	}, 0, nil
+}
+
+func fileConverter(options []string) (patternConverter, recordNeed, error) {
+	return func(buf []byte, r *Record) []byte {
+		file := r.File
+		if i := strings.LastIndexByte(file, '/'); i >= 0 {
+			file = file[i+1:]
+		}
+		return append(buf, file...)
+	}, needCaller, nil
+}
+
+func lineConverter(options []string) (patternConverter, recordNeed, error) {
+	return func(buf []byte, r *Record) []byte {
+		return strconv.AppendInt(buf, int64(r.Line), 10)
+	}, needCaller, nil
+}
+
+func functionConverter(options []string) (patternConverter, recordNeed, error) {
+	return func(buf []byte, r *Record) []byte {
+		return append(buf, r.Function...)
+	}, needFunction, nil
+}
+
+func goroutineConverter(options []string) (patternConverter, recordNeed, error) {
+	return func(buf []byte, r *Record) []byte {
+		return strconv.AppendInt(buf, r.Goroutine, 10)
+	}, needGoroutine, nil
+}
+
+// messageConverter the message, trailing newline trimmed as %n is expected
+func messageConverter(options []string) (patternConverter, recordNeed, error) {
+	return func(buf []byte, r *Record) []byte {
+		return append(buf, strings.TrimSuffix(r.Message, "\n")...)
+	}, 0, nil
+}
+
+// fieldsConverter %X{key} value of the field, %X all fields as key=value key2=value2
+func fieldsConverter(options []string) (patternConverter, recordNeed, error) {
+	if len(options) > 0 && options[0] != "" {
+		key := options[0]
+		return func(buf []byte, r *Record) []byte {
+			for _, f := range r.Fields {
+				if f.Key == key {
+					appendFieldValueText(&buf, f)
+					break
+				}
+			}
+			return buf
+		}, 0, nil
+	}
+	return func(buf []byte, r *Record) []byte {
+		if len(r.Fields) == 0 {
+			return buf
+		}
+		start := len(buf)
+		appendFieldsText(&buf, r.Fields)
+		// Without the leading space
+		return append(buf[:start], buf[start+1:]...)
+	}, 0, nil
+}
+
+func newlineConverter(options []string) (patternConverter, recordNeed, error) {
+	return func(buf []byte, r *Record) []byte {
+		return append(buf, '\n')
+	}, 0, nil
+}
+
+// Named date formats as log4j
+var namedDateFormats = map[string]string{
+	"DEFAULT":  "yyyy-MM-dd HH:mm:ss,SSS",
+	"ISO8601":  "yyyy-MM-dd'T'HH:mm:ss,SSS",
+	"ABSOLUTE": "HH:mm:ss,SSS",
+	"DATE":     "dd MMM yyyy HH:mm:ss,SSS",
+}
+
+// dateWriter appends a part of the time to buf
+type dateWriter func(buf []byte, t time.Time) []byte
+
+// dateConverter %d{format}{zone}
+func dateConverter(options []string) (patternConverter, recordNeed, error) {
+	format := namedDateFormats["DEFAULT"]
+	if len(options) > 0 && options[0] != "" {
+		format = options[0]
+	}
+	if named, ok := namedDateFormats[format]; ok {
+		format = named
+	}
+	writers, err := compileDateFormat(format)
+	if err != nil {
+		return nil, 0, err
+	}
+	var loc *time.Location
+	if len(options) > 1 && options[1] != "" {
+		if loc, err = time.LoadLocation(options[1]); err != nil {
+			return nil, 0, err
+		}
+	}
+	return func(buf []byte, r *Record) []byte {
+		t := r.Time
+		if loc != nil {
+			t = t.In(loc)
+		}
+		for _, w := range writers {
+			buf = w(buf, t)
+		}
+		return buf
+	}, 0, nil
+}
+
+// compileDateFormat compile SimpleDateFormat letters, e.g. yyyy-MM-dd HH:mm:ss.SSS, text quoted by single quotes is literal
+func compileDateFormat(format string) ([]dateWriter, error) {
+	var writers []dateWriter
+	addLiteral := func(text string) {
+		writers = append(writers, func(buf []byte, t time.Time) []byte {
+			return append(buf, text...)
+		})
+	}
+	for i := 0; i < len(format); {
+		c := format[i]
+		switch {
+		case c == '\'':
+			if i+1 < len(format) && format[i+1] == '\'' {
+				addLiteral("'")
+				i += 2
+				continue
+			}
+			// Quoted text, two single quotes in it is a quote
+			var text []byte
+			j := i + 1
+			for ; j < len(format); j++ {
+				if format[j] != '\'' {
+					text = append(text, format[j])
+				} else if j+1 < len(format) && format[j+1] == '\'' {
+					text = append(text, '\'')
+					j++
+				} else {
+					break
+				}
+			}
+			if j >= len(format) {
+				return nil, fmt.Errorf("date format %q has unclosed quote", format)
+			}
+			addLiteral(string(text))
+			i = j + 1
+		case isASCIILetter(c):
+			j := i
+			for j < len(format) && format[j] == c {
+				j++
+			}
+			w, err := dateLetterWriter(c, j-i)
+			if err != nil {
+				return nil, fmt.Errorf("date format %q, %v", format, err)
+			}
+			writers = append(writers, w)
+			i = j
+		default:
+			j := i
+			for j < len(format) && format[j] != '\'' && !isASCIILetter(format[j]) {
+				j++
+			}
+			addLiteral(format[i:j])
+			i = j
+		}
+	}
+	return writers, nil
+}
+
+// dateLetterWriter writer of n repeated SimpleDateFormat letter c
+func dateLetterWriter(c byte, n int) (dateWriter, error) {
+	number := func(value func(t time.Time) int) dateWriter {
+		return func(buf []byte, t time.Time) []byte {
+			itoa(&buf, value(t), n)
+			return buf
+		}
+	}
+	layout := func(goLayout string) dateWriter {
+		return func(buf []byte, t time.Time) []byte {
+			return t.AppendFormat(buf, goLayout)
+		}
+	}
+	switch c {
+	case 'y':
+		if n == 2 {
+			return layout("06"), nil
+		}
+		return number(time.Time.Year), nil
+	case 'M':
+		if n >= 4 {
+			return layout("January"), nil
+		}
+		if n == 3 {
+			return layout("Jan"), nil
+		}
+		return number(func(t time.Time) int { return int(t.Month()) }), nil
+	case 'd':
+		return number(time.Time.Day), nil
+	case 'H':
+		return number(time.Time.Hour), nil
+	case 'h':
+		return number(func(t time.Time) int {
+			if h := t.Hour() % 12; h != 0 {
+				return h
+			}
+			return 12
+		}), nil
+	case 'm':
+		return number(time.Time.Minute), nil
+	case 's':
+		return number(time.Time.Second), nil
+	case 'S':
+		if n > 9 {
+			return nil, fmt.Errorf("too many fraction digits %d", n)
+		}
+		divisor := 1
+		for k := n; k < 9; k++ {
+			divisor *= 10
+		}
+		return func(buf []byte, t time.Time) []byte {
+			itoa(&buf, t.Nanosecond()/divisor, n)
+			return buf
+		}, nil
+	case 'E':
+		if n >= 4 {
+			return layout("Monday"), nil
+		}
+		return layout("Mon"), nil
+	case 'a':
+		return layout("PM"), nil
+	case 'z':
+		return layout("MST"), nil
+	case 'Z':
+		return layout("-0700"), nil
+	case 'X':
+		switch n {
+		case 1:
+			return layout("Z07"), nil
+		case 2:
+			return layout("Z0700"), nil
+		}
+		return layout("Z07:00"), nil
+	}
+	return nil, fmt.Errorf("unsupported date letter %q", c)
+}
@@ -0,0 +1,83 @@
+package p_log4go
+
+import (
+	"bytes"
+	"runtime"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestPatternLayout(t *testing.T) {
+	r := &Record{
+		Time:      time.Date(2021, 6, 13, 15, 4, 5, 7008009, time.UTC),
+		Level:     INFO,
+		File:      "/a/b/c/d.go",
+		Line:      23,
+		Message:   "message\n",
+		Fields:    []Field{String("user", "thiin"), Int("retry", 2)},
+		Logger:    "com.app.db",
+		Function:  "main.handle",
+		Goroutine: 18,
+	}
+	tests := []struct {
+		pattern string
+		want    string
+	}{
+		{"%d{yyyy-MM-dd HH:mm:ss.SSS} [%-5p] %c %F:%L - %m%n", "2021-06-13 15:04:05.007 [INFO ] com.app.db d.go:23 - message\n"},
+		{"%d", "2021-06-13 15:04:05,007"},
+		{"%d{ISO8601}", "2021-06-13T15:04:05,007"},
+		{"%d{ABSOLUTE}|%d{DATE}", "15:04:05,007|13 Jun 2021 15:04:05,007"},
+		{"%d{yy/M/d h:m:s a EEE MMMM SSSSSS}", "21/6/13 3:4:5 PM Sun June 007008"},
+		{"%d{HH:mm}{Asia/Shanghai} %d{'at' HH 'o''clock' XXX}", "23:04 at 15 o'clock Z"},
+		{"[%5p] [%-6p] [%.2c] [%10.4c]", "[ INFO] [INFO  ] [db] [      p.db]"},
+		{"%c{1} %c{2} %c{5}", "db app.db com.app.db"},
+		{"%M %t %X %X{retry} %X{none}|", "main.handle 18 user=thiin retry=2 2 |"},
+		{"%date %level %logger %file %line %method %thread %msg%n", "2021-06-13 15:04:05,007 INFO com.app.db d.go 23 main.handle 18 message\n"},
+		{"100%% %mx", "100% messagex"},
+	}
+	for _, tt := range tests {
+		layout, err := NewPatternLayout(tt.pattern)
+		if err != nil {
+			t.Errorf("pattern %q, %v", tt.pattern, err)
+			continue
+		}
+		if got := string(layout.Format(nil, r)); got != tt.want {
+			t.Errorf("pattern %q got %q, want %q", tt.pattern, got, tt.want)
+		}
+	}
+}
+
+func TestPatternLayoutErrors(t *testing.T) {
+	for _, pattern := range []string{
+		"%",
+		"%q",
+		"%d{yyyy",
+		"%d{yyyy-MM-dd qq}",
+		"%d{'unclosed}",
+		"%d{HH}{No/Such_Zone}",
+		"%c{x}",
+		"%.0p",
+	} {
+		if _, err := NewPatternLayout(pattern); err == nil {
+			t.Errorf("pattern %q should be invalid", pattern)
+		}
+	}
+}
+
+func TestPatternLayoutLogger(t *testing.T) {
+	var buf bytes.Buffer
+	patternLogger := &PLogger{logLevel: DEBUG, out: &buf}
+	patternLogger.SetName("com.app.db")
+	patternLogger.SetFormatter(MustPatternLayout("[%-5p] %c{1} %F:%L %M %t - %m %X%n"))
+	patternLogger.Infow("pattern", String("user", "thiin"))
+	_, _, line, _ := runtime.Caller(0)
+
+	got := buf.String()
+	// Caller, function and goroutine are captured by the layout needs, though the logger flag has no file bits
+	want := "[INFO ] db pattern_layout_test.go:" + strconv.Itoa(line-1) + " p-log4go.TestPatternLayoutLogger " +
+		strconv.FormatInt(goroutineID(), 10) + " - pattern user=thiin\n"
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
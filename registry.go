@@ -0,0 +1,173 @@
+package p_log4go
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// ======== ======== PLogger: Named logger hierarchy ======== ========
+
+// hierarchyMu guards the levels and trace cascading through the hierarchy: levelSet, traceSet and children
+// of the loggers. logLevel and isTraceEnable are stored atomically, so logging reads them without the lock.
+var hierarchyMu sync.Mutex
+
+// loggerRegistry named loggers by dotted name, e.g. com.app.db is a child of com.app
+type loggerRegistry struct {
+	mu      sync.Mutex
+	root    *PLogger
+	loggers map[string]*PLogger
+}
+
+// namedLoggers registry of GetNamedLogger, rooted at the default logger
+var namedLoggers = newLoggerRegistry(defaultLogger)
+
+func newLoggerRegistry(root *PLogger) *loggerRegistry {
+	return &loggerRegistry{root: root, loggers: make(map[string]*PLogger)}
+}
+
+// GetNamedLogger get the logger by dotted name, e.g. com.app.db, created with its ancestors if not exist.
+// Empty name is the root logger, which is the default logger.
+//
+// A named logger inherits the level and trace from its parent until set, following the parent's changes
+// (see SetLevel and StartTrace), and formats by the parent's formatter until its own set. The flag bits and
+// prefix are copied from the parent when created. Records are appended to the logger's own appenders and then
+// to the ancestors' (see SetAdditivity).
+func GetNamedLogger(name string) *PLogger {
+	return namedLoggers.get(name)
+}
+
+// get the logger by name, creating it and its ancestors
+func (reg *loggerRegistry) get(name string) *PLogger {
+	name = strings.Trim(name, ".")
+	if name == "" {
+		return reg.root
+	}
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	return reg.getLocked(name)
+}
+
+func (reg *loggerRegistry) getLocked(name string) *PLogger {
+	if l, ok := reg.loggers[name]; ok {
+		return l
+	}
+	parent := reg.root
+	if i := strings.LastIndexByte(name, '.'); i >= 0 {
+		parent = reg.getLocked(name[:i])
+	}
+	l := &PLogger{name: name, parent: parent}
+	if parent != nil {
+		parent.mu.Lock()
+		l.flag, l.prefix = parent.flag, parent.prefix
+		parent.mu.Unlock()
+		hierarchyMu.Lock()
+		l.logLevel = parent.GetLevel()
+		l.isTraceEnable = atomic.LoadInt32(&parent.isTraceEnable)
+		parent.children = append(parent.children, l)
+		hierarchyMu.Unlock()
+	}
+	reg.loggers[name] = l
+	return l
+}
+
+// Parent logger in the hierarchy, nil for the root and loggers not got by GetNamedLogger
+func (l *PLogger) Parent() *PLogger {
+	return l.parent
+}
+
+// SetLevel set the level of the logger, cascading to the descendants which haven't set their own.
+// It's safe to change while logging.
+func (l *PLogger) SetLevel(level LogLevel) {
+	hierarchyMu.Lock()
+	defer hierarchyMu.Unlock()
+	l.levelSet = true
+	l.cascadeLevel(level)
+}
+
+// ResetLevel inherit the level from the parent again, cascading to the descendants which haven't set their own
+func (l *PLogger) ResetLevel() {
+	if l.parent == nil {
+		return
+	}
+	hierarchyMu.Lock()
+	defer hierarchyMu.Unlock()
+	l.levelSet = false
+	l.cascadeLevel(l.parent.GetLevel())
+}
+
+// cascadeLevel set the level of the logger and the descendants inheriting it. hierarchyMu must be held.
+func (l *PLogger) cascadeLevel(level LogLevel) {
+	l.storeLevel(level)
+	for _, child := range l.children {
+		if !child.levelSet {
+			child.cascadeLevel(level)
+		}
+	}
+}
+
+// ResetTrace inherit trace from the parent again, cascading to the descendants which haven't set their own
+func (l *PLogger) ResetTrace() {
+	if l.parent == nil {
+		return
+	}
+	hierarchyMu.Lock()
+	defer hierarchyMu.Unlock()
+	l.traceSet = false
+	l.cascadeTrace(atomic.LoadInt32(&l.parent.isTraceEnable))
+}
+
+// cascadeTrace set trace of the logger and the descendants inheriting it, 1 to start. hierarchyMu must be held.
+func (l *PLogger) cascadeTrace(enable int32) {
+	atomic.StoreInt32(&l.isTraceEnable, enable)
+	for _, child := range l.children {
+		if !child.traceSet {
+			child.cascadeTrace(enable)
+		}
+	}
+}
+
+// SetAdditivity whether records are also appended to the appenders of the ancestors, true by default.
+// Set false to keep a logger's records out of its ancestors' appenders, as log4j additivity.
+func (l *PLogger) SetAdditivity(additive bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.nonAdditive = !additive
+}
+
+// appendersWithAncestors appenders of the logger, and of its ancestors up to the first non additive one
+func (l *PLogger) appendersWithAncestors() []Appender {
+	l.mu.Lock()
+	appenders, additive := l.appendersLocked(), !l.nonAdditive
+	l.mu.Unlock()
+	if !additive || l.parent == nil {
+		// Copy on write, safe to use without copying
+		return appenders
+	}
+	return l.parent.appendAdditive(append([]Appender(nil), appenders...))
+}
+
+// ancestorAppenders appenders of the ancestors the logger's records reach, up to the first non additive one
+func (l *PLogger) ancestorAppenders() []Appender {
+	l.mu.Lock()
+	additive := !l.nonAdditive
+	l.mu.Unlock()
+	if !additive || l.parent == nil {
+		return nil
+	}
+	return l.parent.appendAdditive(nil)
+}
+
+// appendAdditive append the appenders of the logger and its ancestors to all, up to the first non additive one
+func (l *PLogger) appendAdditive(all []Appender) []Appender {
+	for p := l; p != nil; p = p.parent {
+		p.mu.Lock()
+		all = append(all, p.appendersLocked()...)
+		additive := !p.nonAdditive
+		p.mu.Unlock()
+		if !additive {
+			break
+		}
+	}
+	return all
+}
@@ -0,0 +1,185 @@
+package p_log4go
+
+import (
+	"bufio"
+	"bytes"
+	"testing"
+)
+
+func TestNamedLoggerLevelInheritance(t *testing.T) {
+	root := &PLogger{logLevel: INFO}
+	reg := newLoggerRegistry(root)
+	db := reg.get("com.app.db")
+	app := reg.get("com.app")
+	if db.Parent() != app || app.Parent() != reg.get("com") || reg.get("com").Parent() != root || reg.get("") != root {
+		t.Fatalf("unexpected hierarchy")
+	}
+	if reg.get(".com.app.db.") != db {
+		t.Errorf("dotted name not normalized")
+	}
+
+	levels := func() []LogLevel {
+		return []LogLevel{root.GetLevel(), app.GetLevel(), db.GetLevel()}
+	}
+	assertLevels := func(step string, wants ...LogLevel) {
+		t.Helper()
+		for i, got := range levels() {
+			if got != wants[i] {
+				t.Errorf("%s: got levels %v, want %v", step, levels(), wants)
+				return
+			}
+		}
+	}
+	assertLevels("inherited", INFO, INFO, INFO)
+	root.SetLevel(WARN)
+	assertLevels("cascaded", WARN, WARN, WARN)
+	app.SetLevel(DEBUG)
+	assertLevels("overridden", WARN, DEBUG, DEBUG)
+	root.SetLevel(ERROR)
+	assertLevels("not cascaded to overridden", ERROR, DEBUG, DEBUG)
+	app.ResetLevel()
+	assertLevels("reset", ERROR, ERROR, ERROR)
+	// Created after the changes, inheriting the current level
+	if cache := reg.get("com.app.cache"); cache.GetLevel() != ERROR {
+		t.Errorf("got new logger level %v, want ERROR", cache.GetLevel())
+	}
+}
+
+func TestNamedLoggerTraceAndFormatInheritance(t *testing.T) {
+	var out bytes.Buffer
+	root := &PLogger{logLevel: INFO, out: &out, flag: Lmsgprefix, prefix: "app: "}
+	reg := newLoggerRegistry(root)
+	app := reg.get("com.app")
+	db := reg.get("com.app.db")
+
+	traces := func() []bool {
+		return []bool{root.IsEnabled(trace), app.IsEnabled(trace), db.IsEnabled(trace)}
+	}
+	assertTraces := func(step string, wants ...bool) {
+		t.Helper()
+		for i, got := range traces() {
+			if got != wants[i] {
+				t.Errorf("%s: got traces %v, want %v", step, traces(), wants)
+				return
+			}
+		}
+	}
+	root.StartTrace()
+	assertTraces("cascaded", true, true, true)
+	app.StopTrace()
+	assertTraces("overridden", true, false, false)
+	root.StopTrace()
+	root.StartTrace()
+	assertTraces("not cascaded to overridden", true, false, false)
+	app.ResetTrace()
+	assertTraces("reset", true, true, true)
+	if cache := reg.get("com.app.cache"); !cache.IsEnabled(trace) {
+		t.Errorf("new logger trace off, want inherited on")
+	}
+
+	// The formatter follows the parent's until set, flag bits and prefix are copied when created
+	db.Info("text")
+	app.SetFormatter(MustPatternLayout("%c %m%n"))
+	db.Info("pattern")
+	db.SetFormatter(&TextFormatter{Flag: db.flag})
+	db.Info("own")
+	if got, want := out.String(), "[INFO] app: text\ncom.app.db pattern\n[INFO] app: own\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestNamedLoggerAdditivity(t *testing.T) {
+	var rootOut, appOut, dbOut bytes.Buffer
+	root := &PLogger{logLevel: DEBUG, out: &rootOut}
+	reg := newLoggerRegistry(root)
+	app := reg.get("com.app")
+	app.AttachAppender(NewWriterAppender(&appOut))
+	db := reg.get("com.app.db")
+	db.AttachAppender(NewWriterAppender(&dbOut))
+	// The formatter is inherited too
+	root.SetFormatter(MustPatternLayout("%c:%m%n"))
+
+	db.Info("1")
+	app.SetAdditivity(false)
+	db.Info("2")
+	db.SetAdditivity(false)
+	db.Info("3")
+	root.Info("4")
+
+	tests := []struct {
+		name string
+		out  *bytes.Buffer
+		want string
+	}{
+		{"root", &rootOut, "com.app.db:1\n:4\n"},
+		{"app", &appOut, "com.app.db:1\ncom.app.db:2\n"},
+		{"db", &dbOut, "com.app.db:1\ncom.app.db:2\ncom.app.db:3\n"},
+	}
+	for _, tt := range tests {
+		if got := tt.out.String(); got != tt.want {
+			t.Errorf("%s appender got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+// bufferingAppender appender holding the lines until flushed
+type bufferingAppender struct {
+	out bytes.Buffer
+	w   *bufio.Writer
+}
+
+func newBufferingAppender() *bufferingAppender {
+	a := &bufferingAppender{}
+	a.w = bufio.NewWriterSize(&a.out, 4096)
+	return a
+}
+
+func (a *bufferingAppender) Append(r *Record) error {
+	_, err := a.w.WriteString(r.Level.String() + " " + r.Message + "\n")
+	return err
+}
+
+func (a *bufferingAppender) Flush() error { return a.w.Flush() }
+
+func (a *bufferingAppender) Close() error { return a.w.Flush() }
+
+func TestNamedLoggerPanicFlushesAncestors(t *testing.T) {
+	root := &PLogger{logLevel: DEBUG}
+	rootAppender := newBufferingAppender()
+	root.AttachAppender(rootAppender)
+	reg := newLoggerRegistry(root)
+	db := reg.get("com.app.db")
+	dbAppender := newBufferingAppender()
+	db.AttachAppender(dbAppender)
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Errorf("not panicked")
+			}
+		}()
+		db.Panic("broken")
+	}()
+	if got := rootAppender.out.String(); got != "PANIC broken\n" {
+		t.Errorf("root appender got %q, want flushed on panic", got)
+	}
+	if got := dbAppender.out.String(); got != "PANIC broken\n" {
+		t.Errorf("db appender got %q, want flushed on panic", got)
+	}
+
+	// Closing flushes the ancestors' appenders without closing them
+	db.Info("closing")
+	db.Close()
+	if got := rootAppender.out.String(); got != "PANIC broken\nINFO closing\n" {
+		t.Errorf("root appender got %q, want flushed on close", got)
+	}
+
+	// Not flushing the appenders a non additive logger doesn't reach
+	cache := reg.get("com.app.cache")
+	cache.SetAdditivity(false)
+	root.Info("buffered")
+	cache.Sync()
+	if got := rootAppender.out.String(); got != "PANIC broken\nINFO closing\n" {
+		t.Errorf("root appender got %q, want not flushed by a non additive logger", got)
+	}
+}
@@ -0,0 +1,113 @@
+package p_log4go
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ======== ======== PLogger: Rotated archives retention ======== ========
+
+// archiveFile a rotated archive of the writer, e.g. app.log.2021-06-13 or app.log.2021-06-13.2.gz
+type archiveFile struct {
+	path       string    // File path
+	stamp      string    // Period stamp in name, formatted by writer format
+	time       time.Time // Period time parsed from stamp
+	index      int       // Archive number in the period, 0 if not numbered
+	compressed bool      // Whether compressed, e.g. app.log.2021-06-13.gz
+	size       int64     // File size
+	modTime    time.Time // File mod time
+}
+
+// listArchives list archives matching the writer archive naming scheme, newest first
+func (w *timedRotatingWriter) listArchives() ([]archiveFile, error) {
+	dir, base := filepath.Split(w.filename)
+	if dir == "" {
+		dir = "."
+	}
+	fileInfos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := base + "."
+	compressedExt := w.compressedExt()
+	archives := make([]archiveFile, 0)
+	for _, fileInfo := range fileInfos {
+		name := fileInfo.Name()
+		compressed := strings.HasSuffix(name, compressedExt)
+		if compressed {
+			name = strings.TrimSuffix(name, compressedExt)
+		}
+		if fileInfo.IsDir() || !strings.HasPrefix(name, prefix) || len(name) < len(prefix)+len(w.format) {
+			continue
+		}
+		stamp := name[len(prefix) : len(prefix)+len(w.format)]
+		stampTime, err := time.ParseInLocation(w.format, stamp, w.location)
+		if err != nil {
+			continue
+		}
+		index := 0
+		if suffix := name[len(prefix)+len(w.format):]; suffix != "" {
+			if suffix[0] != '.' {
+				continue
+			}
+			if index, err = strconv.Atoi(suffix[1:]); err != nil || index <= 0 {
+				continue
+			}
+		}
+		archives = append(archives, archiveFile{
+			path:       filepath.Join(dir, fileInfo.Name()),
+			stamp:      stamp,
+			time:       stampTime,
+			index:      index,
+			compressed: compressed,
+			size:       fileInfo.Size(),
+			modTime:    fileInfo.ModTime(),
+		})
+	}
+
+	sort.Slice(archives, func(i, j int) bool {
+		if !archives[i].time.Equal(archives[j].time) {
+			return archives[i].time.After(archives[j].time)
+		}
+		return archives[i].index > archives[j].index
+	})
+	return archives, nil
+}
+
+// cleanup delete archives of periods beyond the rotate count, older than max age or over the total bytes budget.
+// The numbered archives of a period rotated by size count as one, and those of the current period are not counted,
+// as the live file isn't.
+func (w *timedRotatingWriter) cleanup() error {
+	if w.rotate <= 0 && w.maxAge <= 0 && w.maxTotalBytes <= 0 {
+		return nil
+	}
+	archives, err := w.listArchives()
+	if err != nil {
+		return err
+	}
+
+	now := w.now()
+	current := w.periodOf(now).Format(w.format)
+	oldest := now.Add(-w.maxAge)
+	var totalBytes, periods int64
+	for i, archive := range archives {
+		if archive.stamp != current && (i == 0 || archive.stamp != archives[i-1].stamp) {
+			periods++
+		}
+		totalBytes += archive.size
+		if (w.rotate > 0 && periods > w.rotate) ||
+			(w.maxAge > 0 && archive.modTime.Before(oldest)) ||
+			(w.maxTotalBytes > 0 && totalBytes > w.maxTotalBytes) {
+			if err = os.Remove(archive.path); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+	return nil
+}
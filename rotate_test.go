@@ -0,0 +1,583 @@
+package p_log4go
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// countLines count lines of all files in dir whose name has the prefix
+func countLines(t *testing.T, dir string, prefix string) int {
+	fileInfos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := 0
+	for _, fileInfo := range fileInfos {
+		if !strings.HasPrefix(fileInfo.Name(), prefix) {
+			continue
+		}
+		f, err := os.Open(filepath.Join(dir, fileInfo.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			lines++
+		}
+		f.Close()
+	}
+	return lines
+}
+
+func TestSizeRotate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "plog4go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	logPath := filepath.Join(dir, "size.log")
+	sizeLogger, err := GetLogger3(logPath, INFO, RotateConf{Interval: Daily, Rotate: 10, MaxBytes: 256}, false, FileAppender)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 20; i++ {
+		sizeLogger.Info("INFO. Line %02d should be rotated by size.", i)
+	}
+
+	archives, _ := filepath.Glob(logPath + ".*")
+	if len(archives) < 3 {
+		t.Fatalf("got %d archives, want at least 3", len(archives))
+	}
+	for _, archive := range archives {
+		fileInfo, err := os.Stat(archive)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fileInfo.Size() > 256 {
+			t.Errorf("archive %s size %d exceeds max bytes", archive, fileInfo.Size())
+		}
+	}
+	for _, index := range []string{".1", ".2", ".3"} {
+		if matches, _ := filepath.Glob(logPath + ".*" + index); len(matches) != 1 {
+			t.Errorf("numbered archive %s not found", index)
+		}
+	}
+	if lines := countLines(t, dir, "size.log"); lines != 20 {
+		t.Errorf("got %d lines, want 20", lines)
+	}
+}
+
+func TestSizeRotateWithInterval(t *testing.T) {
+	dir, err := ioutil.TempDir("", "plog4go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	logPath := filepath.Join(dir, "interval.log")
+	w, err := newTimedRotateWriter(logPath, RotateConf{Interval: Hourly, Rotate: 3, MaxBytes: 64})
+	if err != nil {
+		t.Fatal(err)
+	}
+	line := []byte(strings.Repeat("x", 39) + "\n")
+	w.Write(line)
+
+	// Pretend the period changed, the live file should be archived after the existing numbered archive
+	w.setPeriod(w.periodOf(w.period.Add(-time.Nanosecond)))
+	prevStamp := w.period.Format(w.format)
+	if err = ioutil.WriteFile(logPath+"."+prevStamp+".1", line, 0644); err != nil {
+		t.Fatal(err)
+	}
+	w.Write(line)
+
+	if _, err := os.Stat(logPath + "." + prevStamp + ".2"); err != nil {
+		t.Errorf("archive %s not found, %v", prevStamp+".2", err)
+	}
+	if w.size != int64(len(line)) {
+		t.Errorf("got size %d, want %d", w.size, len(line))
+	}
+}
+
+// touchArchives create archives named by the stamps, with mod time of each stamp
+func touchArchives(t *testing.T, logPath string, format string, stamps ...string) {
+	for _, stamp := range stamps {
+		name := logPath + "." + stamp
+		if err := ioutil.WriteFile(name, []byte("archive\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if stampTime, err := time.ParseInLocation(format, stamp[:len(format)], time.Local); err == nil {
+			os.Chtimes(name, stampTime, stampTime)
+		}
+	}
+}
+
+func assertExists(t *testing.T, logPath string, exist bool, suffixes ...string) {
+	for _, suffix := range suffixes {
+		_, err := os.Stat(logPath + suffix)
+		if exist && err != nil {
+			t.Errorf("%s should exist, %v", logPath+suffix, err)
+		}
+		if !exist && !os.IsNotExist(err) {
+			t.Errorf("%s should be deleted, %v", logPath+suffix, err)
+		}
+	}
+}
+
+func TestRetentionWithGaps(t *testing.T) {
+	dir, err := ioutil.TempDir("", "plog4go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	logPath := filepath.Join(dir, "gap.log")
+	format := "2006-01-02"
+	day := func(n int) string {
+		return time.Now().AddDate(0, 0, -n).Format(format)
+	}
+	// Archives with gaps, e.g. process was down over a weekend
+	touchArchives(t, logPath, format, day(1), day(3), day(4), day(8), day(20))
+	touchArchives(t, logPath, format, day(9)+".1", day(9)+".2")
+	// Not archives of the writer
+	ioutil.WriteFile(logPath+".bak", nil, 0644)
+	ioutil.WriteFile(logPath+".2021-13-99", nil, 0644)
+	ioutil.WriteFile(logPath+"."+day(30)+".x", nil, 0644)
+
+	// Retention runs when the writer starts
+	if _, err = newTimedRotateWriter(logPath, RotateConf{Interval: Daily, Rotate: 3}); err != nil {
+		t.Fatal(err)
+	}
+	assertExists(t, logPath, true, "", "."+day(1), "."+day(3), "."+day(4))
+	assertExists(t, logPath, false, "."+day(8), "."+day(9)+".1", "."+day(9)+".2", "."+day(20))
+	assertExists(t, logPath, true, ".bak", ".2021-13-99", "."+day(30)+".x")
+}
+
+func TestRetentionNumberedArchives(t *testing.T) {
+	dir, err := ioutil.TempDir("", "plog4go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	logPath := filepath.Join(dir, "numbered.log")
+	format := "2006-01-02_15"
+	hour := func(n int) string {
+		return time.Now().Add(time.Duration(-n) * time.Hour).Format(format)
+	}
+	stamp := hour(1)
+	touchArchives(t, logPath, format, stamp+".1", stamp+".2", stamp+".10", hour(2)+".1", hour(3)+".1", hour(3)+".2")
+
+	// The numbered archives of an hour count as one
+	w, err := newTimedRotateWriter(logPath, RotateConf{Interval: Hourly, Rotate: 2, MaxBytes: 1024})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertExists(t, logPath, true, "."+stamp+".1", "."+stamp+".2", "."+stamp+".10", "."+hour(2)+".1")
+	assertExists(t, logPath, false, "."+hour(3)+".1", "."+hour(3)+".2")
+	if name := w.nextArchiveName(w.periodOf(w.period.Add(-time.Nanosecond))); name != logPath+"."+stamp+".11" {
+		t.Errorf("got next archive %s, want %s", name, logPath+"."+stamp+".11")
+	}
+}
+
+func TestRetentionSizeAndTimeRotate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "plog4go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	logPath := filepath.Join(dir, "mixed.log")
+	clock := &fakeClock{now: time.Date(2021, 6, 13, 10, 0, 0, 0, time.Local)}
+	w, err := newTimedRotateWriter(logPath, RotateConf{Interval: Daily, Rotate: 2, MaxBytes: 64, clock: clock.Now})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	line := []byte(strings.Repeat("x", 39) + "\n")
+	// 4 archives by size each day, then the day archived by time
+	for day := 13; day <= 16; day++ {
+		clock.Set(time.Date(2021, 6, day, 10, 0, 0, 0, time.Local))
+		for i := 0; i < 5; i++ {
+			w.Write(line)
+		}
+	}
+
+	// All archives of the last 2 days are kept, besides today's
+	for _, day := range []string{".2021-06-14", ".2021-06-15"} {
+		assertExists(t, logPath, true, day+".1", day+".2", day+".3", day+".4", day+".5")
+	}
+	assertExists(t, logPath, true, "", ".2021-06-16.1", ".2021-06-16.4")
+	if matches, _ := filepath.Glob(logPath + ".2021-06-13.*"); len(matches) != 0 {
+		t.Errorf("got archives %v of the 3rd day back, want deleted", matches)
+	}
+	if lines := countLines(t, dir, "mixed.log"); lines != 15 {
+		t.Errorf("got %d lines, want 15", lines)
+	}
+}
+
+func TestRetentionMaxAgeAndTotalBytes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "plog4go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	logPath := filepath.Join(dir, "budget.log")
+	format := "2006-01-02"
+	day := func(n int) string {
+		return time.Now().AddDate(0, 0, -n).Format(format)
+	}
+	touchArchives(t, logPath, format, day(1), day(2), day(3), day(4), day(10))
+
+	// Each archive is 8 bytes, budget keeps 3 of them, max age drops the 10 days old one
+	w, err := newTimedRotateWriter(logPath, RotateConf{Interval: Daily, MaxAge: 7 * 24 * time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertExists(t, logPath, true, "."+day(1), "."+day(2), "."+day(3), "."+day(4))
+	assertExists(t, logPath, false, "."+day(10))
+
+	w.maxTotalBytes = 24
+	if err = w.cleanup(); err != nil {
+		t.Fatal(err)
+	}
+	assertExists(t, logPath, true, "."+day(1), "."+day(2), "."+day(3))
+	assertExists(t, logPath, false, "."+day(4))
+
+	// Ages by the clock of the writer
+	later := time.Now().Add(4*24*time.Hour + 12*time.Hour)
+	w.now = func() time.Time { return later }
+	if err = w.cleanup(); err != nil {
+		t.Fatal(err)
+	}
+	assertExists(t, logPath, true, "."+day(1))
+	assertExists(t, logPath, false, "."+day(3))
+}
+
+// TestMultiProcessRotate runs processes logging to the same file rotated by size, no line should be lost to clobbered archives
+func TestMultiProcessRotate(t *testing.T) {
+	const processes, linesPerProcess = 4, 500
+	if logPath := os.Getenv("PLOG4GO_MULTI_PROCESS_LOG"); logPath != "" {
+		sharedLogger, err := GetLogger3(logPath, INFO, RotateConf{Interval: Daily, Rotate: 1000, MaxBytes: 2048, MultiProcess: true}, false, FileAppender)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < linesPerProcess; i++ {
+			sharedLogger.Info("INFO. Process %d line %03d.", os.Getpid(), i)
+		}
+		sharedLogger.Close()
+		return
+	}
+
+	dir, err := ioutil.TempDir("", "plog4go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	logPath := filepath.Join(dir, "shared.log")
+	cmds := make([]*exec.Cmd, processes)
+	for i := range cmds {
+		cmds[i] = exec.Command(os.Args[0], "-test.run=^TestMultiProcessRotate$")
+		cmds[i].Env = append(os.Environ(), "PLOG4GO_MULTI_PROCESS_LOG="+logPath)
+		if err = cmds[i].Start(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, cmd := range cmds {
+		if err = cmd.Wait(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	archives, _ := filepath.Glob(logPath + ".*-*")
+	if len(archives) < processes*linesPerProcess*30/2048 {
+		t.Errorf("got %d archives, want rotated by size", len(archives))
+	}
+	if lines := countLines(t, dir, "shared.log"); lines != processes*linesPerProcess {
+		t.Errorf("got %d lines, want %d", lines, processes*linesPerProcess)
+	}
+}
+
+// TestExternalRotate moves, truncates and deletes the file as logrotate does, the writer should follow the path
+func TestExternalRotate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "plog4go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	logPath := filepath.Join(dir, "external.log")
+	externalLogger, err := GetLogger(logPath, INFO, Daily, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer externalLogger.Close()
+	w := externalLogger.appenders[0].(*WriterAppender).w.(*timedRotatingWriter)
+	// Write after the check interval, as if a second passed
+	expireCheck := func() {
+		w.lock.Lock()
+		w.checkedAt = time.Time{}
+		w.lock.Unlock()
+	}
+	assertContent := func(path string, want string) {
+		t.Helper()
+		content, _ := ioutil.ReadFile(path)
+		if got := strings.Count(string(content), "\n"); !strings.Contains(string(content), want) || got != 1 {
+			t.Errorf("got %s with %d lines %q, want 1 line %q", filepath.Base(path), got, content, want)
+		}
+	}
+
+	externalLogger.Info("before moved")
+	if err = os.Rename(logPath, logPath+".1"); err != nil {
+		t.Fatal(err)
+	}
+	expireCheck()
+	externalLogger.Info("after moved")
+	assertContent(logPath+".1", "before moved")
+	assertContent(logPath, "after moved")
+
+	// copytruncate
+	if err = os.Truncate(logPath, 0); err != nil {
+		t.Fatal(err)
+	}
+	expireCheck()
+	externalLogger.Info("after truncated")
+	assertContent(logPath, "after truncated")
+	if info, _ := os.Stat(logPath); w.size != info.Size() {
+		t.Errorf("got size %d, want %d", w.size, info.Size())
+	}
+
+	// Reopen on SIGHUP, without waiting for the check
+	stop := externalLogger.ReopenOnSignal()
+	defer stop()
+	if err = os.Remove(logPath); err != nil {
+		t.Fatal(err)
+	}
+	syscall.Kill(os.Getpid(), syscall.SIGHUP)
+	for i := 0; i < 100; i++ {
+		if _, err = os.Stat(logPath); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	externalLogger.Info("after deleted")
+	assertContent(logPath, "after deleted")
+}
+
+// TestRotateFailure makes the dir unwritable, output should go to the fallback and rotating retried
+func TestRotateFailure(t *testing.T) {
+	dir, err := ioutil.TempDir("", "plog4go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	logDir := filepath.Join(dir, "logs")
+	logPath := filepath.Join(logDir, "failure.log")
+	var fallback bytes.Buffer
+	var errs []error
+	failureLogger, err := GetLogger3(logPath, INFO, RotateConf{Interval: Daily, Rotate: 10, MaxBytes: 256,
+		Fallback: &fallback, OnError: func(err error) { errs = append(errs, err) }}, false, FileAppender)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer failureLogger.Close()
+	failureLogger.SetFormatter(MustPatternLayout("%m%n"))
+	w := failureLogger.appenders[0].(*WriterAppender).w.(*timedRotatingWriter)
+	// Write after the retry and check intervals, as if a second passed
+	expireRetry := func() {
+		w.lock.Lock()
+		w.retryAt, w.checkedAt = time.Time{}, time.Time{}
+		w.lock.Unlock()
+	}
+	line := strings.Repeat("x", 100)
+
+	if os.Geteuid() != 0 {
+		// Read only dir: renaming fails, writing goes on to the current file
+		failureLogger.Info("%s 1", line)
+		failureLogger.Info("%s 2", line)
+		if err = os.Chmod(logDir, 0555); err != nil {
+			t.Fatal(err)
+		}
+		failureLogger.Info("%s 3 over max bytes", line)
+		os.Chmod(logDir, 0755)
+		if len(errs) == 0 || !strings.Contains(errs[0].Error(), "rename") {
+			t.Errorf("got errors %v, want rename error", errs)
+		}
+		if content, _ := ioutil.ReadFile(logPath); !strings.Contains(string(content), "3 over max bytes") {
+			t.Errorf("got %q, want written to the current file", content)
+		}
+		expireRetry()
+		failureLogger.Info("%s 4 rotated", line)
+		if archives, _ := filepath.Glob(logPath + ".*"); len(archives) != 1 {
+			t.Errorf("got archives %v, want rotated after retried", archives)
+		}
+		errs = nil
+	}
+
+	// Dir removed, so root is denied too: opening fails, output goes to the fallback
+	if err = os.RemoveAll(logDir); err != nil {
+		t.Fatal(err)
+	}
+	expireRetry()
+	for i := 0; i < 3; i++ {
+		failureLogger.Info("%s %d to fallback", line, i)
+	}
+	if len(errs) == 0 || !strings.Contains(errs[0].Error(), "open") {
+		t.Errorf("got errors %v, want open error", errs)
+	}
+	if got := strings.Count(fallback.String(), "to fallback\n"); got != 3 {
+		t.Errorf("got %d lines to fallback %q, want 3", got, fallback.String())
+	}
+
+	// Opening retried after the dir is back
+	if err = os.MkdirAll(logDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	expireRetry()
+	failureLogger.Info("back to file")
+	if content, _ := ioutil.ReadFile(logPath); string(content) != "back to file\n" {
+		t.Errorf("got %q, want back to file", content)
+	}
+}
+
+// fakeClock a clock moved by tests, read by the mill goroutine too
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Set(now time.Time) {
+	c.mu.Lock()
+	c.now = now
+	c.mu.Unlock()
+}
+
+// TestRotateAcrossDST rotates by the local calendar while DST starts and ends, and in a configured zone
+func TestRotateAcrossDST(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("time zone database not available, %v", err)
+	}
+	dir, err := ioutil.TempDir("", "plog4go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name       string
+		interval   RotateInterval
+		location   *time.Location
+		compressor Compressor
+		steps      []time.Time // Written at each, then archived if next step is in another period
+		archives   []string
+	}{
+		{
+			// 2021-03-14 is 23 hours long
+			name: "daily.log", interval: Daily, location: newYork,
+			steps: []time.Time{
+				time.Date(2021, 3, 13, 12, 0, 0, 0, newYork),
+				time.Date(2021, 3, 14, 0, 0, 0, 0, newYork),
+				time.Date(2021, 3, 14, 23, 59, 59, 0, newYork),
+				time.Date(2021, 3, 15, 0, 0, 0, 0, newYork),
+			},
+			archives: []string{".2021-03-13", ".2021-03-14"},
+		},
+		{
+			// 01:00 ~ 02:00 repeats on 2021-11-07
+			name: "hourly.log", interval: Hourly, location: newYork,
+			steps: []time.Time{
+				time.Date(2021, 11, 7, 0, 30, 0, 0, newYork),
+				time.Date(2021, 11, 7, 5, 30, 0, 0, time.UTC), // 01:30 EDT
+				time.Date(2021, 11, 7, 6, 30, 0, 0, time.UTC), // 01:30 EST
+				time.Date(2021, 11, 7, 7, 30, 0, 0, time.UTC), // 02:30 EST
+			},
+			archives: []string{".2021-11-07_00", ".2021-11-07_01", ".2021-11-07_01.1"},
+		},
+		{
+			// The first 01 hour is compressed before the second rotated
+			name: "hourly_gz.log", interval: Hourly, location: newYork, compressor: GzipCompressor,
+			steps: []time.Time{
+				time.Date(2021, 11, 7, 0, 30, 0, 0, newYork),
+				time.Date(2021, 11, 7, 5, 30, 0, 0, time.UTC), // 01:30 EDT
+				time.Date(2021, 11, 7, 6, 30, 0, 0, time.UTC), // 01:30 EST
+				time.Date(2021, 11, 7, 7, 30, 0, 0, time.UTC), // 02:30 EST
+			},
+			archives: []string{".2021-11-07_00.gz", ".2021-11-07_01.1.gz", ".2021-11-07_01.gz"},
+		},
+		{
+			// Weeks start on Monday midnight of the zone
+			name: "weekly.log", interval: Weekly, location: time.FixedZone("UTC+8", 8*3600),
+			steps: []time.Time{
+				time.Date(2021, 6, 13, 15, 59, 59, 0, time.UTC), // Sunday 23:59:59 +8
+				time.Date(2021, 6, 13, 16, 0, 0, 0, time.UTC),   // Monday 00:00 +8
+				time.Date(2021, 6, 20, 15, 0, 0, 0, time.UTC),
+			},
+			archives: []string{".2021-06-07"},
+		},
+	}
+	for _, tt := range tests {
+		clock := &fakeClock{now: tt.steps[0]}
+		logPath := filepath.Join(dir, tt.name)
+		w, err := newTimedRotateWriter(logPath, RotateConf{Interval: tt.interval, Rotate: 10, Location: tt.location,
+			Compressor: tt.compressor, clock: clock.Now})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, step := range tt.steps {
+			clock.Set(step)
+			w.Write([]byte(step.In(tt.location).Format(time.RFC3339) + "\n"))
+			if tt.compressor != nil {
+				waitFor(t, 5*time.Second, func() bool {
+					archives, _ := w.listArchives()
+					for _, archive := range archives {
+						if !archive.compressed {
+							return false
+						}
+					}
+					return true
+				})
+			}
+		}
+		w.Close()
+
+		archives, _ := filepath.Glob(logPath + ".*")
+		lines := 0
+		for i := range archives {
+			if strings.HasSuffix(archives[i], ".gz") {
+				lines += gzipLines(t, archives[i])
+			} else {
+				raw, _ := ioutil.ReadFile(archives[i])
+				lines += strings.Count(string(raw), "\n")
+			}
+			archives[i] = strings.TrimPrefix(archives[i], logPath)
+		}
+		if current, err := ioutil.ReadFile(logPath); err == nil {
+			lines += strings.Count(string(current), "\n")
+		}
+		if got, want := strings.Join(archives, ","), strings.Join(tt.archives, ","); got != want {
+			t.Errorf("%s got archives %s, want %s", tt.name, got, want)
+		}
+		if lines != len(tt.steps) {
+			t.Errorf("%s got %d lines, want %d", tt.name, lines, len(tt.steps))
+		}
+	}
+}
@@ -0,0 +1,327 @@
+package p_log4go
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ======== ======== PLogger: Syslog appender ======== ========
+
+// SyslogFormat syslog message format
+type SyslogFormat int8
+
+const (
+	RFC5424 SyslogFormat = iota // <PRI>1 TIMESTAMP HOSTNAME APP-NAME PROCID MSGID [SD] MSG
+	RFC3164                     // <PRI>Mmm dd hh:mm:ss HOSTNAME TAG[PID]: MSG, the BSD format
+)
+
+// SyslogFacility syslog facility, LOCAL0 ~ LOCAL7 are for applications
+type SyslogFacility int8
+
+const (
+	USER   SyslogFacility = 1
+	DAEMON SyslogFacility = 3
+	LOCAL0 SyslogFacility = 16
+	LOCAL1 SyslogFacility = 17
+	LOCAL2 SyslogFacility = 18
+	LOCAL3 SyslogFacility = 19
+	LOCAL4 SyslogFacility = 20
+	LOCAL5 SyslogFacility = 21
+	LOCAL6 SyslogFacility = 22
+	LOCAL7 SyslogFacility = 23
+)
+
+// Syslog severities
+const (
+	severityEmerg = iota
+	severityAlert
+	severityCrit
+	severityErr
+	severityWarning
+	severityNotice
+	severityInfo
+	severityDebug
+)
+
+// syslogSeverity syslog severity of the level
+func syslogSeverity(level LogLevel) int {
+	switch {
+	case level >= FATAL:
+		return severityAlert
+	case level >= PANIC:
+		return severityCrit
+	case level >= ERROR:
+		return severityErr
+	case level >= WARN:
+		return severityWarning
+	case level >= INFO:
+		return severityInfo
+	}
+	return severityDebug
+}
+
+// SyslogConf syslog appender conf
+type SyslogConf struct {
+	Network  string         // udp, tcp or unixgram. Empty means the local syslog socket, e.g. /dev/log
+	Addr     string         // e.g. 127.0.0.1:514, or the socket path of unixgram
+	Format   SyslogFormat   // RFC5424 by default
+	Facility SyslogFacility // USER if 0, use LOCAL0 ~ LOCAL7 for applications
+	AppName  string         // APP-NAME or TAG, the program name by default
+	Hostname string         // HOSTNAME, os.Hostname by default
+	SDID     string         // SD-ID of the structured data from log fields, fields@32473 by default
+
+	WriteTimeout time.Duration // Deadline of each write, a write timed out redials as a broken one. 5s by default
+}
+
+// defaultSyslogSDID 32473 is the private enterprise number reserved for documentation (RFC 5612)
+const defaultSyslogSDID = "fields@32473"
+
+// localSyslogPaths unix datagram sockets of the local syslog
+var localSyslogPaths = []string{"/dev/log", "/var/run/syslog", "/var/run/log"}
+
+// SyslogAppender appender to syslog over UDP, TCP with octet-counted framing (RFC 6587) or unix datagram sockets
+type SyslogAppender struct {
+	conf  SyslogConf
+	pid   string
+	level int32 // Min LogLevel appended
+
+	mu     sync.Mutex // ensures atomic writes; protects the following fields
+	conn   net.Conn   // Connection, redialed once if a write fails
+	buf    []byte     // for accumulating text to write
+	frame  []byte     // for framing the message over tcp
+	closed bool       // whether closed
+}
+
+// NewSyslogAppender appender dialing syslog by the conf
+func NewSyslogAppender(conf SyslogConf) (*SyslogAppender, error) {
+	if conf.Network != "" && conf.Network != "udp" && conf.Network != "tcp" && conf.Network != "unixgram" {
+		return nil, fmt.Errorf("unsupported syslog network %q", conf.Network)
+	}
+	if conf.Facility < 0 || conf.Facility > LOCAL7 {
+		return nil, fmt.Errorf("invalid syslog facility %d", conf.Facility)
+	}
+	if conf.Facility == 0 {
+		conf.Facility = USER
+	}
+	if conf.AppName == "" {
+		conf.AppName = filepath.Base(os.Args[0])
+	}
+	if conf.Hostname == "" {
+		conf.Hostname, _ = os.Hostname()
+	}
+	if conf.SDID == "" {
+		conf.SDID = defaultSyslogSDID
+	}
+	if conf.WriteTimeout <= 0 {
+		conf.WriteTimeout = 5 * time.Second
+	}
+	a := &SyslogAppender{conf: conf, pid: strconv.Itoa(os.Getpid())}
+	conn, err := a.dial()
+	if err != nil {
+		return nil, err
+	}
+	a.conn = conn
+	return a, nil
+}
+
+// dial connects to syslog
+func (a *SyslogAppender) dial() (net.Conn, error) {
+	if a.conf.Network != "" {
+		conn, err := net.DialTimeout(a.conf.Network, a.conf.Addr, 5*time.Second)
+		if err != nil {
+			return nil, fmt.Errorf("dial syslog err, %v", err)
+		}
+		return conn, nil
+	}
+	for _, path := range localSyslogPaths {
+		if conn, err := net.Dial("unixgram", path); err == nil {
+			return conn, nil
+		}
+	}
+	return nil, errors.New("local syslog socket not found")
+}
+
+// SetLevel set min level appended. It's safe to change while logging.
+func (a *SyslogAppender) SetLevel(level LogLevel) {
+	atomic.StoreInt32(&a.level, int32(level))
+}
+
+// Level min level appended
+func (a *SyslogAppender) Level() LogLevel {
+	return LogLevel(atomic.LoadInt32(&a.level))
+}
+
+// Append formats the record as a syslog message and sends it, if its level is enabled
+func (a *SyslogAppender) Append(r *Record) error {
+	if r.Level < a.Level() {
+		return nil
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.closed {
+		return ErrClosed
+	}
+	if a.conf.Format == RFC3164 {
+		a.buf = a.appendRFC3164(a.buf[:0], r)
+	} else {
+		a.buf = a.appendRFC5424(a.buf[:0], r)
+	}
+	msg := a.buf
+	if a.conf.Network == "tcp" {
+		// Octet-counted framing: MSG-LEN SP MSG
+		a.frame = strconv.AppendInt(a.frame[:0], int64(len(a.buf)), 10)
+		a.frame = append(append(a.frame, ' '), a.buf...)
+		msg = a.frame
+	}
+	if err := a.writeLocked(msg); err != nil {
+		// Connection broken, e.g. syslog restarted, or stalled with a frame maybe partly written.
+		// Close it, and redial once. If the dial fails, the next write fails on the closed one and redials.
+		a.conn.Close()
+		conn, dialErr := a.dial()
+		if dialErr != nil {
+			return err
+		}
+		a.conn = conn
+		return a.writeLocked(msg)
+	}
+	return nil
+}
+
+// writeLocked write the message with the write deadline. a.mu must be held.
+func (a *SyslogAppender) writeLocked(msg []byte) error {
+	a.conn.SetWriteDeadline(time.Now().Add(a.conf.WriteTimeout))
+	_, err := a.conn.Write(msg)
+	return err
+}
+
+// appendRFC5424 <PRI>1 TIMESTAMP HOSTNAME APP-NAME PROCID MSGID [SD-ID key="value"...] MSG
+func (a *SyslogAppender) appendRFC5424(buf []byte, r *Record) []byte {
+	buf = a.appendPRI(buf, r.Level)
+	buf = append(buf, '1', ' ')
+	buf = r.Time.AppendFormat(buf, "2006-01-02T15:04:05.000000Z07:00")
+	buf = append(buf, ' ')
+	buf = appendSyslogHeaderField(buf, a.conf.Hostname, 255)
+	buf = append(buf, ' ')
+	buf = appendSyslogHeaderField(buf, a.conf.AppName, 48)
+	buf = append(buf, ' ')
+	buf = appendSyslogHeaderField(buf, a.pid, 128)
+	buf = append(buf, " - "...)
+	if len(r.Fields) == 0 {
+		buf = append(buf, '-')
+	} else {
+		buf = append(buf, '[')
+		buf = append(buf, a.conf.SDID...)
+		for _, f := range r.Fields {
+			buf = append(buf, ' ')
+			buf = appendSyslogParamName(buf, f.Key)
+			buf = append(buf, '=', '"')
+			buf = appendSyslogParamValue(buf, fieldValueString(f))
+			buf = append(buf, '"')
+		}
+		buf = append(buf, ']')
+	}
+	if msg := strings.TrimSuffix(r.Message, "\n"); msg != "" {
+		buf = append(buf, ' ')
+		buf = append(buf, msg...)
+	}
+	return buf
+}
+
+// appendRFC3164 <PRI>Mmm dd hh:mm:ss HOSTNAME TAG[PID]: MSG key=value
+func (a *SyslogAppender) appendRFC3164(buf []byte, r *Record) []byte {
+	buf = a.appendPRI(buf, r.Level)
+	buf = r.Time.AppendFormat(buf, time.Stamp)
+	buf = append(buf, ' ')
+	buf = appendSyslogHeaderField(buf, a.conf.Hostname, 255)
+	buf = append(buf, ' ')
+	buf = appendSyslogHeaderField(buf, a.conf.AppName, 32)
+	buf = append(buf, '[')
+	buf = append(buf, a.pid...)
+	buf = append(buf, "]: "...)
+	buf = append(buf, strings.TrimSuffix(r.Message, "\n")...)
+	appendFieldsText(&buf, r.Fields)
+	return buf
+}
+
+// appendPRI <facility * 8 + severity>
+func (a *SyslogAppender) appendPRI(buf []byte, level LogLevel) []byte {
+	buf = append(buf, '<')
+	buf = strconv.AppendInt(buf, int64(a.conf.Facility)*8+int64(syslogSeverity(level)), 10)
+	return append(buf, '>')
+}
+
+// Flush nothing buffered, messages are sent when appended
+func (a *SyslogAppender) Flush() error {
+	return nil
+}
+
+// Close closes the connection
+func (a *SyslogAppender) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.closed {
+		return nil
+	}
+	a.closed = true
+	return a.conn.Close()
+}
+
+// appendSyslogHeaderField header field of printable US-ASCII up to max length, "-" if empty
+func appendSyslogHeaderField(buf []byte, s string, max int) []byte {
+	if s == "" {
+		return append(buf, '-')
+	}
+	for i := 0; i < len(s) && i < max; i++ {
+		if c := s[i]; c > ' ' && c < 0x7f {
+			buf = append(buf, c)
+		} else {
+			buf = append(buf, '_')
+		}
+	}
+	return buf
+}
+
+// appendSyslogParamName PARAM-NAME of printable US-ASCII except '=', ' ', ']' and '"', up to 32 chars
+func appendSyslogParamName(buf []byte, s string) []byte {
+	if s == "" {
+		return append(buf, '_')
+	}
+	for i := 0; i < len(s) && i < 32; i++ {
+		if c := s[i]; c > ' ' && c < 0x7f && c != '=' && c != ']' && c != '"' {
+			buf = append(buf, c)
+		} else {
+			buf = append(buf, '_')
+		}
+	}
+	return buf
+}
+
+// appendSyslogParamValue PARAM-VALUE with '"', '\' and ']' escaped
+func appendSyslogParamValue(buf []byte, s string) []byte {
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c == '"' || c == '\\' || c == ']' {
+			buf = append(buf, '\\')
+		}
+		buf = append(buf, s[i])
+	}
+	return buf
+}
+
+// fieldValueString the field value as plain text, not quoted
+func fieldValueString(f Field) string {
+	switch f.Type {
+	case StringField:
+		return f.Str
+	case TimeField:
+		return f.Any.(time.Time).Format(time.RFC3339Nano)
+	}
+	return fmt.Sprint(f.Value())
+}
@@ -0,0 +1,199 @@
+package p_log4go
+
+import (
+	"bufio"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSyslogSeverity(t *testing.T) {
+	tests := []struct {
+		level LogLevel
+		want  int
+	}{
+		{trace, 7}, {DEBUG, 7}, {INFO, 6}, {WARN, 4}, {ERROR, 3}, {PANIC, 2}, {FATAL, 1},
+	}
+	for _, tt := range tests {
+		if got := syslogSeverity(tt.level); got != tt.want {
+			t.Errorf("%v got severity %d, want %d", tt.level, got, tt.want)
+		}
+	}
+}
+
+func TestSyslogUDP(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+
+	appender, err := NewSyslogAppender(SyslogConf{Network: "udp", Addr: pc.LocalAddr().String(),
+		Facility: LOCAL0, AppName: "my app", Hostname: "host1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	syslogLogger := &PLogger{logLevel: DEBUG}
+	syslogLogger.AttachAppender(appender)
+	defer syslogLogger.Close()
+
+	syslogLogger.Infow("login\n", String("user", "thiin"), String("quo\"te]", `a"b\c]`), Int("n", 3))
+	syslogLogger.Warn("no fields")
+
+	// LOCAL0(16) * 8 + info(6) = 134, LOCAL0 * 8 + warning(4) = 132
+	pid := strconv.Itoa(os.Getpid())
+	wants := []*regexp.Regexp{
+		regexp.MustCompile(`^<134>1 \d{4}-\d\d-\d\dT\d\d:\d\d:\d\d\.\d{6}(Z|[+-]\d\d:\d\d) host1 my_app ` + pid +
+			` - \[fields@32473 user="thiin" quo_te_="a\\"b\\\\c\\]" n="3"\] login$`),
+		regexp.MustCompile(`^<132>1 \S+ host1 my_app ` + pid + ` - - no fields$`),
+	}
+	buf := make([]byte, 2048)
+	for _, want := range wants {
+		pc.SetReadDeadline(time.Now().Add(5 * time.Second))
+		n, _, err := pc.ReadFrom(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !want.Match(buf[:n]) {
+			t.Errorf("got %q, want match %s", buf[:n], want)
+		}
+	}
+}
+
+func TestSyslogTCPFraming(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	appender, err := NewSyslogAppender(SyslogConf{Network: "tcp", Addr: ln.Addr().String(), Hostname: "host1", AppName: "app"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer appender.Close()
+	appender.SetLevel(INFO)
+	syslogLogger := &PLogger{logLevel: DEBUG, appenders: []Appender{appender}}
+	syslogLogger.Debug("below appender level")
+	syslogLogger.Info("first")
+	syslogLogger.Error("second line\nwith newline")
+
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	r := bufio.NewReader(conn)
+	// USER(1) * 8 + info(6) = 14, USER * 8 + err(3) = 11
+	for _, want := range []string{"<14>1 ", "<11>1 "} {
+		length, err := r.ReadString(' ')
+		if err != nil {
+			t.Fatal(err)
+		}
+		n, err := strconv.Atoi(strings.TrimSuffix(length, " "))
+		if err != nil {
+			t.Fatalf("invalid frame length %q", length)
+		}
+		msg := make([]byte, n)
+		if _, err := io.ReadFull(r, msg); err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(string(msg), want) {
+			t.Errorf("got %q, want prefix %q", msg, want)
+		}
+	}
+}
+
+func TestSyslogTCPWriteTimeout(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	// Accepts, but never reads
+	accepted := make(chan net.Conn, 256)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			accepted <- conn
+		}
+	}()
+	defer func() {
+		for len(accepted) > 0 {
+			(<-accepted).Close()
+		}
+	}()
+
+	appender, err := NewSyslogAppender(SyslogConf{Network: "tcp", Addr: ln.Addr().String(), WriteTimeout: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer appender.Close()
+	r := &Record{Level: INFO, Time: time.Now(), Message: strings.Repeat("x", 1<<20)}
+	// Fills the socket buffers, then times out and redials
+	for i := 0; i < 128 && len(accepted) < 2; i++ {
+		start := time.Now()
+		appender.Append(r)
+		if elapsed := time.Since(start); elapsed > 2*time.Second {
+			t.Fatalf("append blocked for %v", elapsed)
+		}
+	}
+	waitFor(t, 5*time.Second, func() bool { return len(accepted) >= 2 })
+}
+
+func TestSyslogUnixgramRFC3164(t *testing.T) {
+	dir, err := ioutil.TempDir("", "plog4go-syslog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	sock := filepath.Join(dir, "log.sock")
+	pc, err := net.ListenPacket("unixgram", sock)
+	if err != nil {
+		t.Skipf("unixgram not supported, %v", err)
+	}
+	defer pc.Close()
+
+	appender, err := NewSyslogAppender(SyslogConf{Network: "unixgram", Addr: sock, Format: RFC3164,
+		Facility: LOCAL7, AppName: "app", Hostname: "host1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer appender.Close()
+	appender.Append(&Record{Time: time.Date(2021, 6, 3, 9, 4, 5, 0, time.Local), Level: ERROR,
+		Message: "disk full\n", Fields: []Field{Int("free", 0)}})
+
+	buf := make([]byte, 2048)
+	pc.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := pc.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// LOCAL7(23) * 8 + err(3) = 187
+	want := "<187>Jun  3 09:04:05 host1 app[" + strconv.Itoa(os.Getpid()) + "]: disk full free=0"
+	if got := string(buf[:n]); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestSyslogConfInvalid(t *testing.T) {
+	for _, conf := range []SyslogConf{
+		{Network: "http", Addr: "127.0.0.1:514"},
+		{Network: "udp", Addr: "127.0.0.1:514", Facility: 24},
+	} {
+		if _, err := NewSyslogAppender(conf); err == nil {
+			t.Errorf("conf %+v should be invalid", conf)
+		}
+	}
+}